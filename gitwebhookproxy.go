@@ -1,18 +1,24 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"log"
 	"os"
+	"os/signal"
 	"strings"
+	"syscall"
+	"time"
 
 	"github.com/namsral/flag"
+	"github.com/stakater/GitWebhookProxy/pkg/config"
 	"github.com/stakater/GitWebhookProxy/pkg/proxy"
 )
 
 var (
 	flagSet       = flag.NewFlagSetWithEnvPrefix(os.Args[0], "GWP", 0)
 	listenAddress = flagSet.String("listen", ":8080", "Address on which the proxy listens.")
+	configFile    = flagSet.String("config", "", "Path to a YAML configuration file with per-upstream settings")
 	upstreamURL   = flagSet.String("upstreamURL", "", "URL to which the proxy requests will be forwarded") // Removed (required)
 	upstreamURLs  = flagSet.String("upstreamURLs", "", "Comma-Separated String List of additional upstream URLs")
 	secret        = flagSet.String("secret", "", "Secret of the Webhook API. If not set validation is not made.")
@@ -20,15 +26,50 @@ var (
 	allowedPaths  = flagSet.String("allowedPaths", "", "Comma-Separated String List of allowed paths")
 	ignoredUsers  = flagSet.String("ignoredUsers", "", "Comma-Separated String List of users to ignore while proxying Webhook request")
 	allowedUsers  = flagSet.String("allowedUser", "", "Comma-Separated String List of users to allow while proxying Webhook request")
+	maxBodySize   = flagSet.Int64("maxBodySize", 25<<20, "Maximum size in bytes of a Webhook request body, larger ones are rejected with 413. 0 disables the limit")
+
+	groupsFile           = flagSet.String("groupsFile", "", "Path to a YAML, JSON or CODEOWNERS-style file with the members of the @groups used in ignoredUsers and allowedUser")
+	groupsReloadInterval = flagSet.Duration("groupsReloadInterval", time.Second*30, "Interval at which groupsFile is checked for changes")
+
+	ignoreBots      = flagSet.Bool("ignoreBots", false, "Ignore Webhook requests sent by bots like dependabot[bot] or GitLab project bots")
+	botEmailDomains = flagSet.String("botEmailDomains", "", "Comma-Separated String List of email domains of service accounts treated as bots")
+
+	tlsCertFile       = flagSet.String("tlsCertFile", "", "Path to the TLS certificate. Serves HTTPS when set together with tlsKeyFile")
+	tlsKeyFile        = flagSet.String("tlsKeyFile", "", "Path to the TLS private key")
+	tlsClientCAFile   = flagSet.String("tlsClientCAFile", "", "Path to a CA bundle used to verify client certificates (mTLS)")
+	tlsClientAuth     = flagSet.String("tlsClientAuth", "", "Client certificate policy: none, request, require, verify-if-given or require-and-verify")
+	tlsMinVersion     = flagSet.String("tlsMinVersion", "1.2", "Minimum TLS version: 1.0, 1.1, 1.2 or 1.3")
+	tlsMaxVersion     = flagSet.String("tlsMaxVersion", "", "Maximum TLS version: 1.0, 1.1, 1.2 or 1.3")
+	tlsCipherSuites   = flagSet.String("tlsCipherSuites", "", "Comma-Separated String List of allowed TLS cipher suites (Go names)")
+	tlsReloadInterval = flagSet.Duration("tlsReloadInterval", time.Second*30, "Interval at which TLS certificate files are checked for changes")
+
+	upstreamHealthPath        = flagSet.String("upstreamHealthPath", "", "Path probed on every upstream's host, or an absolute URL. Upstream health checks are disabled when empty")
+	upstreamHealthInterval    = flagSet.Duration("upstreamHealthInterval", time.Second*15, "Interval between upstream health checks")
+	upstreamHealthTimeout     = flagSet.Duration("upstreamHealthTimeout", time.Second*5, "Timeout of a single upstream health check")
+	readinessRequiresUpstream = flagSet.Bool("readinessRequiresUpstream", false, "Fail /readyz unless at least one upstream passes its health check")
+
+	circuitBreakerFailures  = flagSet.Int("circuitBreakerFailures", 0, "Consecutive failures after which an upstream's circuit opens. 0 disables this trigger")
+	circuitBreakerErrorRate = flagSet.Float64("circuitBreakerErrorRate", 0, "Failure ratio (0-1) over the last circuitBreakerWindow deliveries at which an upstream's circuit opens. 0 disables this trigger")
+	circuitBreakerWindow    = flagSet.Int("circuitBreakerWindow", 20, "Number of recent deliveries used to compute circuitBreakerErrorRate")
+	circuitBreakerCooldown  = flagSet.Duration("circuitBreakerCooldown", time.Second*30, "Time an open circuit waits before letting a trial delivery through")
+
+	adminListen = flagSet.String("adminListen", "", "Address of the admin listener, e.g. 127.0.0.1:8081. The admin API is disabled when empty")
+	adminToken  = flagSet.String("adminToken", "", "Bearer token required by every request to the admin API")
+
+	deliveryLogSize = flagSet.Int("deliveryLogSize", 100, "Number of recent deliveries kept for the admin API. 0 disables the delivery log")
+	deliveryLogFile = flagSet.String("deliveryLogFile", "", "Path to a file in which recent deliveries are persisted across restarts")
+
+	shutdownDelay       = flagSet.Duration("shutdownDelay", time.Second*5, "Time to keep serving with a failing health check on SIGTERM before closing listeners")
+	shutdownGracePeriod = flagSet.Duration("shutdownGracePeriod", time.Second*25, "Total time allowed for shutdown, including shutdownDelay. Keep it below the pod's terminationGracePeriodSeconds")
 )
 
-func validateRequiredFlags() {
+func validateRequiredFlags(cfg *config.Config) {
 	isValid := true
 	trimmedUpstreamURL := strings.TrimSpace(*upstreamURL)
 	trimmedUpstreamURLs := strings.TrimSpace(*upstreamURLs)
 
-	if len(trimmedUpstreamURL) == 0 && len(trimmedUpstreamURLs) == 0 {
-		log.Println("Required flag 'upstreamURL' or 'upstreamURLs' must be specified")
+	if len(trimmedUpstreamURL) == 0 && len(trimmedUpstreamURLs) == 0 && len(cfg.Upstreams) == 0 {
+		log.Println("Required flag 'upstreamURL' or 'upstreamURLs', or upstreams in the 'config' file, must be specified")
 		isValid = false
 	}
 
@@ -58,6 +99,53 @@ func validateRequiredFlags() {
 		}
 	}
 
+	if (len(*tlsCertFile) > 0) != (len(*tlsKeyFile) > 0) {
+		log.Println("Flags 'tlsCertFile' and 'tlsKeyFile' must be specified together")
+		isValid = false
+	}
+
+	if len(*tlsCertFile) == 0 {
+		// Without a certificate the proxy serves plain HTTP, so any TLS policy
+		// flag would be silently ignored
+		tlsPolicyFlags := map[string]string{
+			"tlsClientCAFile": *tlsClientCAFile,
+			"tlsClientAuth":   *tlsClientAuth,
+			"tlsCipherSuites": *tlsCipherSuites,
+			"tlsMaxVersion":   *tlsMaxVersion,
+		}
+		for _, name := range []string{"tlsClientCAFile", "tlsClientAuth", "tlsCipherSuites", "tlsMaxVersion"} {
+			if len(strings.TrimSpace(tlsPolicyFlags[name])) > 0 {
+				log.Printf("Flag '%s' requires 'tlsCertFile' and 'tlsKeyFile' to be specified", name)
+				isValid = false
+			}
+		}
+	}
+
+	if *maxBodySize < 0 {
+		log.Println("Flag 'maxBodySize' must not be negative")
+		isValid = false
+	}
+
+	if len(*adminListen) > 0 && len(*adminToken) == 0 {
+		log.Println("Flag 'adminToken' must be specified together with 'adminListen'")
+		isValid = false
+	}
+
+	if *deliveryLogSize < 0 {
+		log.Println("Flag 'deliveryLogSize' must not be negative")
+		isValid = false
+	}
+
+	if len(*deliveryLogFile) > 0 && *deliveryLogSize == 0 {
+		log.Println("Flag 'deliveryLogFile' requires 'deliveryLogSize' to be greater than 0")
+		isValid = false
+	}
+
+	if *circuitBreakerErrorRate < 0 || *circuitBreakerErrorRate > 1 {
+		log.Println("Flag 'circuitBreakerErrorRate' must be between 0 and 1")
+		isValid = false
+	}
+
 	if !isValid {
 		fmt.Println("")
 		//TODO: Usage not working as expected in flagSet
@@ -68,25 +156,30 @@ func validateRequiredFlags() {
 	}
 }
 
-func main() {
-	flagSet.Parse(os.Args[1:])
-	validateRequiredFlags()
-	lowerProvider := strings.ToLower(*provider)
-
-	// Split Comma-Separated list into an array
-	allowedPathsArray := []string{}
-	if len(*allowedPaths) > 0 {
-		allowedPathsArray = strings.Split(*allowedPaths, ",")
+// reloadConfig loads the configuration file again and applies it together
+// with the upstreams it lists
+func reloadConfig(p *proxy.Proxy) error {
+	cfg := &config.Config{}
+	if len(*configFile) > 0 {
+		loaded, err := config.Load(*configFile)
+		if err != nil {
+			return fmt.Errorf("Error loading config file '%s': %s", *configFile, err)
+		}
+		cfg = loaded
 	}
 
-	// Split Comma-Separated list into an array
-	ignoredUsersArray := []string{}
-	if len(*ignoredUsers) > 0 {
-		ignoredUsersArray = strings.Split(*ignoredUsers, ",")
+	allUpstreamURLs := consolidateUpstreamURLs(cfg)
+	if err := p.SetUpstreamURLs(allUpstreamURLs); err != nil {
+		return err
 	}
+	p.ApplyConfig(cfg)
+	log.Printf("Reloaded config, consolidated upstream URLs: %v", allUpstreamURLs)
+	return nil
+}
 
-	log.Printf("Stakater Git WebHook Proxy started with provider '%s'\n", lowerProvider)
-
+// consolidateUpstreamURLs merges the upstreamURL and upstreamURLs flags with
+// the upstreams of the configuration file, dropping duplicates
+func consolidateUpstreamURLs(cfg *config.Config) []string {
 	allUpstreamURLs := []string{}
 	seenURLs := make(map[string]bool)
 
@@ -114,6 +207,56 @@ func main() {
 		}
 	}
 
+	for _, currentURL := range cfg.UpstreamURLs() {
+		if !seenURLs[currentURL] {
+			allUpstreamURLs = append(allUpstreamURLs, currentURL)
+			seenURLs[currentURL] = true
+		}
+	}
+
+	return allUpstreamURLs
+}
+
+func main() {
+	if len(os.Args) > 1 && os.Args[1] == "replay" {
+		os.Exit(runReplay(os.Args[2:]))
+	}
+
+	flagSet.Parse(os.Args[1:])
+
+	cfg := &config.Config{}
+	if len(*configFile) > 0 {
+		loaded, err := config.Load(*configFile)
+		if err != nil {
+			log.Fatalf("Error loading config file '%s': %s", *configFile, err)
+		}
+		cfg = loaded
+	}
+
+	validateRequiredFlags(cfg)
+	lowerProvider := strings.ToLower(*provider)
+
+	// Split Comma-Separated list into an array
+	allowedPathsArray := []string{}
+	if len(*allowedPaths) > 0 {
+		allowedPathsArray = strings.Split(*allowedPaths, ",")
+	}
+
+	// Split Comma-Separated list into an array
+	ignoredUsersArray := []string{}
+	if len(*ignoredUsers) > 0 {
+		ignoredUsersArray = strings.Split(*ignoredUsers, ",")
+	}
+
+	// Split Comma-Separated list into an array
+	allowedUsersArray := []string{}
+	if len(*allowedUsers) > 0 {
+		allowedUsersArray = strings.Split(*allowedUsers, ",")
+	}
+
+	log.Printf("Stakater Git WebHook Proxy started with provider '%s'\n", lowerProvider)
+
+	allUpstreamURLs := consolidateUpstreamURLs(cfg)
 	log.Printf("Consolidated upstream URLs: %v", allUpstreamURLs)
 
 	p, err := proxy.NewProxy(allUpstreamURLs, allowedPathsArray, lowerProvider, *secret, ignoredUsersArray)
@@ -121,8 +264,103 @@ func main() {
 		log.Fatal(err)
 	}
 
-	if err := p.Run(*listenAddress); err != nil {
-		log.Fatal(err)
+	p.ApplyConfig(cfg)
+	p.SetAllowedUsers(allowedUsersArray)
+	p.SetMaxBodySize(*maxBodySize)
+
+	if len(*groupsFile) > 0 {
+		if err := p.LoadGroups(*groupsFile, *groupsReloadInterval); err != nil {
+			log.Fatalf("Error loading groups file: %s", err)
+		}
+	}
+
+	if *deliveryLogSize > 0 {
+		err := p.EnableDeliveryLog(proxy.DeliveryLogOptions{
+			Size: *deliveryLogSize,
+			File: *deliveryLogFile,
+		})
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	botEmailDomainsArray := []string{}
+	if len(*botEmailDomains) > 0 {
+		botEmailDomainsArray = strings.Split(*botEmailDomains, ",")
+	}
+	p.ConfigureBots(proxy.BotOptions{
+		Ignore:       *ignoreBots,
+		EmailDomains: botEmailDomainsArray,
+	})
+
+	p.ConfigureCircuitBreakers(proxy.CircuitBreakerOptions{
+		ConsecutiveFailures: *circuitBreakerFailures,
+		ErrorRate:           *circuitBreakerErrorRate,
+		Window:              *circuitBreakerWindow,
+		Cooldown:            *circuitBreakerCooldown,
+	})
+
+	p.StartHealthChecks(proxy.HealthCheckOptions{
+		Path:            *upstreamHealthPath,
+		Interval:        *upstreamHealthInterval,
+		Timeout:         *upstreamHealthTimeout,
+		RequireUpstream: *readinessRequiresUpstream,
+	})
+
+	var tlsOptions *proxy.TLSOptions
+	if len(*tlsCertFile) > 0 {
+		tlsCipherSuitesArray := []string{}
+		if len(*tlsCipherSuites) > 0 {
+			tlsCipherSuitesArray = strings.Split(*tlsCipherSuites, ",")
+		}
+
+		tlsOptions = &proxy.TLSOptions{
+			CertFile:       *tlsCertFile,
+			KeyFile:        *tlsKeyFile,
+			ClientCAFile:   *tlsClientCAFile,
+			ClientAuth:     *tlsClientAuth,
+			MinVersion:     *tlsMinVersion,
+			MaxVersion:     *tlsMaxVersion,
+			CipherSuites:   tlsCipherSuitesArray,
+			ReloadInterval: *tlsReloadInterval,
+		}
 	}
 
+	runErrors := make(chan error, 2)
+	if len(*adminListen) > 0 {
+		go func() {
+			runErrors <- p.RunAdmin(proxy.AdminOptions{
+				Address: *adminListen,
+				Token:   *adminToken,
+				Reload:  func() error { return reloadConfig(p) },
+				TLS:     tlsOptions,
+			})
+		}()
+	}
+
+	go func() {
+		if tlsOptions != nil {
+			runErrors <- p.RunTLS(*listenAddress, *tlsOptions)
+			return
+		}
+
+		runErrors <- p.Run(*listenAddress)
+	}()
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGTERM, syscall.SIGINT)
+
+	select {
+	case err := <-runErrors:
+		if err != nil {
+			log.Fatal(err)
+		}
+	case sig := <-signals:
+		log.Printf("Received signal '%s', shutting down within %s", sig, *shutdownGracePeriod)
+		ctx, cancel := context.WithTimeout(context.Background(), *shutdownGracePeriod)
+		defer cancel()
+		if err := p.Shutdown(ctx, *shutdownDelay); err != nil {
+			log.Printf("Error during shutdown: %s", err)
+		}
+	}
 }
@@ -6,4 +6,5 @@ require (
 	github.com/jarcoal/httpmock v1.0.4
 	github.com/julienschmidt/httprouter v1.3.0
 	github.com/namsral/flag v1.7.4-pre
+	gopkg.in/yaml.v2 v2.4.0
 )
@@ -0,0 +1,322 @@
+package config
+
+import (
+	"fmt"
+	"io/ioutil"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v2"
+)
+
+// Config is the optional configuration file of the proxy. Everything that
+// can differ between upstreams lives here, the global settings remain flags.
+type Config struct {
+	// Filters apply to every hook before it is fanned out to the upstreams
+	Filters   Filters    `yaml:"filters"`
+	Upstreams []Upstream `yaml:"upstreams"`
+	// RateLimits apply to the hooks received on matching paths, the first
+	// matching rule wins
+	RateLimits []RateLimitRule `yaml:"rateLimits"`
+	// Coalesce collapses rapid pushes received on matching paths, the first
+	// matching rule wins
+	Coalesce []CoalesceRule `yaml:"coalesce"`
+}
+
+// CoalesceRule delays pushes received on the matching paths by Window. Pushes
+// to the same repository and ref within the window are collapsed and only
+// the last one to arrive is forwarded when the window closes.
+type CoalesceRule struct {
+	// Paths the rule applies to, every path when empty
+	Paths  Patterns `yaml:"paths"`
+	Window Duration `yaml:"window"`
+}
+
+// RateLimitRule limits the hooks received on the matching paths, per client
+// IP, per repository and per upstream
+type RateLimitRule struct {
+	// Paths the rule applies to, every path when empty
+	Paths Patterns `yaml:"paths"`
+	// TrustForwardedFor takes the client IP from the last address of
+	// X-Forwarded-For, the one added by the load balancer or ingress in
+	// front of the proxy
+	TrustForwardedFor bool      `yaml:"trustForwardedFor"`
+	IP                RateLimit `yaml:"ip"`
+	Repository        RateLimit `yaml:"repository"`
+	Upstream          RateLimit `yaml:"upstream"`
+}
+
+// RateLimit is a token bucket refilled with PerMinute tokens a minute and
+// holding at most Burst tokens. A zero PerMinute disables the limit.
+type RateLimit struct {
+	PerMinute float64 `yaml:"perMinute"`
+	// Burst defaults to PerMinute, and to 1 below one hook a minute
+	Burst int `yaml:"burst"`
+	// Wait queues a hook over the limit for up to this long before it is
+	// rejected with 429
+	Wait Duration `yaml:"wait"`
+}
+
+// Enabled is true for limits with a rate
+func (l RateLimit) Enabled() bool {
+	return l.PerMinute > 0
+}
+
+// Filters decide which hooks are forwarded. A hook that does not pass is
+// acknowledged with 200 and the reason instead of being forwarded.
+type Filters struct {
+	Events EventFilter `yaml:"events"`
+	// Refs match the full refs of a hook, e.g. refs/heads/main. Hooks without
+	// a ref, like issue comments, are not affected.
+	Refs Patterns `yaml:"refs"`
+	// Paths match the files added, modified or removed by the commits of a
+	// push. Other hooks, and pushes without commits, are not affected.
+	Paths Patterns `yaml:"paths"`
+	// Expression must evaluate to true for the hook to pass, see ExpressionVariables
+	Expression Expression `yaml:"expression"`
+	SkipCI     SkipCI     `yaml:"skipCI"`
+}
+
+// SkipCI drops pushes whose commit messages contain one of the markers, e.g.
+// [skip ci]. Markers are matched case-insensitively.
+type SkipCI struct {
+	Markers []string `yaml:"markers"`
+	// HeadCommitOnly checks only the head commit instead of requiring the
+	// marker in every commit of the push
+	HeadCommitOnly bool `yaml:"headCommitOnly"`
+}
+
+// EventFilter matches provider event types, e.g. push or "Merge Request Hook".
+// An empty Allow list allows every event that is not denied.
+type EventFilter struct {
+	Allow []string `yaml:"allow"`
+	Deny  []string `yaml:"deny"`
+}
+
+// Upstream configures a single upstream URL
+type Upstream struct {
+	URL string `yaml:"url"`
+	// HealthURL overrides the upstreamHealthPath probe for this upstream
+	HealthURL   string      `yaml:"healthURL"`
+	Timeouts    Timeouts    `yaml:"timeouts"`
+	Connections Connections `yaml:"connections"`
+	// Filters decide which hooks reach this upstream, on top of the global ones
+	Filters Filters `yaml:"filters"`
+	// CloudEvents wraps each hook sent to this upstream in a CloudEvent
+	CloudEvents CloudEvents `yaml:"cloudEvents"`
+	// Transform builds the request sent to this upstream from the hook
+	Transform Transform `yaml:"transform"`
+	// Headers decide which headers of the hook are forwarded to this upstream
+	Headers HeaderRules `yaml:"headers"`
+}
+
+// HeaderRules rewrite the headers forwarded to an upstream. Allow and Deny
+// hold header names, matched case-insensitively, where a trailing '*'
+// matches any suffix, e.g. X-Hub-Signature*.
+type HeaderRules struct {
+	// Allow forwards only the matching headers, every header when empty
+	Allow []string `yaml:"allow"`
+	// Deny drops the matching headers, it wins over Allow
+	Deny []string `yaml:"deny"`
+	// Set adds static headers, replacing forwarded ones of the same name
+	Set map[string]string `yaml:"set"`
+}
+
+// Transform replaces the body of the hook and adds headers, e.g. to send a
+// form to a Jenkins buildWithParameters endpoint. Both are templates executed
+// with the decoded payload, see Template.
+type Transform struct {
+	Body    Template            `yaml:"body"`
+	Headers map[string]Template `yaml:"headers"`
+}
+
+const (
+	// CloudEventsStructured sends the whole event as an application/cloudevents+json body
+	CloudEventsStructured = "structured"
+	// CloudEventsBinary sends the attributes as ce-* headers and the payload as the body
+	CloudEventsBinary = "binary"
+)
+
+// CloudEvents configures the CloudEvents HTTP binding used for an upstream.
+// An empty Mode forwards hooks as they were received.
+type CloudEvents struct {
+	Mode string `yaml:"mode"`
+}
+
+// Timeouts of requests to an upstream. Zero values keep the defaults.
+type Timeouts struct {
+	Connect        Duration `yaml:"connect"`
+	TLSHandshake   Duration `yaml:"tlsHandshake"`
+	ResponseHeader Duration `yaml:"responseHeader"`
+	Overall        Duration `yaml:"overall"`
+}
+
+// Connections tunes the connection pool of an upstream. Zero values keep the defaults.
+type Connections struct {
+	MaxIdle        int      `yaml:"maxIdle"`
+	MaxIdlePerHost int      `yaml:"maxIdlePerHost"`
+	IdleTimeout    Duration `yaml:"idleTimeout"`
+	KeepAlive      Duration `yaml:"keepAlive"`
+	// DisableKeepAlives opens a new connection for every delivery
+	DisableKeepAlives bool `yaml:"disableKeepAlives"`
+	// HTTP2 set to false forces HTTP/1.1, true attempts HTTP/2
+	HTTP2 *bool `yaml:"http2"`
+}
+
+// Duration is a time.Duration read from strings like "30s" or "1m"
+type Duration time.Duration
+
+// UnmarshalYAML implements yaml.Unmarshaler
+func (d *Duration) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var value string
+	if err := unmarshal(&value); err != nil {
+		return err
+	}
+	parsed, err := time.ParseDuration(value)
+	if err != nil {
+		return err
+	}
+	*d = Duration(parsed)
+	return nil
+}
+
+// MarshalYAML implements yaml.Marshaler
+func (d Duration) MarshalYAML() (interface{}, error) {
+	return time.Duration(d).String(), nil
+}
+
+// Load reads and validates the configuration file at path
+func Load(path string) (*Config, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return Parse(data)
+}
+
+// Parse decodes and validates a YAML (or JSON) configuration
+func Parse(data []byte) (*Config, error) {
+	cfg := &Config{}
+	if err := yaml.UnmarshalStrict(data, cfg); err != nil {
+		return nil, err
+	}
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+// Validate checks the configuration for mistakes that would only surface
+// when a hook is delivered
+func (c *Config) Validate() error {
+	if err := c.Filters.validate("filters"); err != nil {
+		return err
+	}
+	for i := range c.RateLimits {
+		rule := &c.RateLimits[i]
+		names := []string{"ip", "repository", "upstream"}
+		for j, limit := range []RateLimit{rule.IP, rule.Repository, rule.Upstream} {
+			if limit.PerMinute < 0 || limit.Burst < 0 || limit.Wait < 0 {
+				return fmt.Errorf("rateLimits[%d].%s: perMinute, burst and wait must not be negative", i, names[j])
+			}
+		}
+	}
+	for i, rule := range c.Coalesce {
+		if rule.Window <= 0 {
+			return fmt.Errorf("coalesce[%d]: window must be positive", i)
+		}
+	}
+	seen := make(map[string]bool)
+	for i := range c.Upstreams {
+		upstream := &c.Upstreams[i]
+		url := strings.TrimSpace(upstream.URL)
+		upstream.URL = url
+		if len(url) == 0 {
+			return fmt.Errorf("upstreams[%d]: url must not be empty", i)
+		}
+		if !strings.HasPrefix(url, "http://") && !strings.HasPrefix(url, "https://") {
+			return fmt.Errorf("upstreams[%d]: url '%s' must start with http:// or https://", i, url)
+		}
+		if IsURLTemplate(url) {
+			if _, err := ParseURLTemplate(url); err != nil {
+				return fmt.Errorf("upstreams[%d]: url '%s' is not a valid template: %s", i, url, err)
+			}
+		}
+		if seen[url] {
+			return fmt.Errorf("upstreams[%d]: url '%s' is configured more than once", i, url)
+		}
+		seen[url] = true
+		if upstream.Timeouts.Connect < 0 || upstream.Timeouts.TLSHandshake < 0 ||
+			upstream.Timeouts.ResponseHeader < 0 || upstream.Timeouts.Overall < 0 {
+			return fmt.Errorf("upstreams[%d]: timeouts must not be negative", i)
+		}
+		if upstream.Connections.MaxIdle < 0 || upstream.Connections.MaxIdlePerHost < 0 {
+			return fmt.Errorf("upstreams[%d]: connection limits must not be negative", i)
+		}
+		if err := upstream.Filters.validate(fmt.Sprintf("upstreams[%d].filters", i)); err != nil {
+			return err
+		}
+		upstream.CloudEvents.Mode = strings.ToLower(strings.TrimSpace(upstream.CloudEvents.Mode))
+		switch upstream.CloudEvents.Mode {
+		case "", CloudEventsStructured, CloudEventsBinary:
+		default:
+			return fmt.Errorf("upstreams[%d].cloudEvents: mode '%s' must be %s or %s",
+				i, upstream.CloudEvents.Mode, CloudEventsStructured, CloudEventsBinary)
+		}
+		if len(upstream.CloudEvents.Mode) > 0 && !upstream.Transform.Body.Empty() {
+			return fmt.Errorf("upstreams[%d]: transform.body cannot be combined with cloudEvents", i)
+		}
+		if err := upstream.Headers.validate(fmt.Sprintf("upstreams[%d].headers", i)); err != nil {
+			return err
+		}
+		for name := range upstream.Transform.Headers {
+			if len(strings.TrimSpace(name)) == 0 {
+				return fmt.Errorf("upstreams[%d].transform.headers: header names must not be empty", i)
+			}
+		}
+	}
+	return nil
+}
+
+func (h *HeaderRules) validate(path string) error {
+	for _, list := range [][]string{h.Allow, h.Deny} {
+		for i := range list {
+			list[i] = strings.TrimSpace(list[i])
+			if len(list[i]) == 0 {
+				return fmt.Errorf("%s: header names must not be empty", path)
+			}
+		}
+	}
+	for name := range h.Set {
+		if len(strings.TrimSpace(name)) == 0 {
+			return fmt.Errorf("%s.set: header names must not be empty", path)
+		}
+	}
+	return nil
+}
+
+func (f *Filters) validate(path string) error {
+	for _, list := range [][]string{f.Events.Allow, f.Events.Deny} {
+		for i := range list {
+			list[i] = strings.TrimSpace(list[i])
+			if len(list[i]) == 0 {
+				return fmt.Errorf("%s.events: event types must not be empty", path)
+			}
+		}
+	}
+	for _, marker := range f.SkipCI.Markers {
+		if len(strings.TrimSpace(marker)) == 0 {
+			return fmt.Errorf("%s.skipCI: markers must not be empty", path)
+		}
+	}
+	return nil
+}
+
+// UpstreamURLs returns the URLs of all configured upstreams in order
+func (c *Config) UpstreamURLs() []string {
+	urls := []string{}
+	for _, upstream := range c.Upstreams {
+		urls = append(urls, upstream.URL)
+	}
+	return urls
+}
@@ -0,0 +1,166 @@
+package config
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParse(t *testing.T) {
+	cfg, err := Parse([]byte(`
+filters:
+  events:
+    deny: [star, watch, fork]
+  refs: [refs/heads/main, "!refs/tags/*"]
+  expression: event != "push" || !payload.deleted
+coalesce:
+  - paths: ["/jenkins/**"]
+    window: 1m
+rateLimits:
+  - paths: ["/jenkins/**"]
+    trustForwardedFor: true
+    repository:
+      perMinute: 10
+      burst: 5
+      wait: 30s
+  - ip:
+      perMinute: 600
+upstreams:
+  - url: " https://argo.example.com/hook "
+    healthURL: https://argo.example.com/healthz
+    timeouts:
+      connect: 2s
+      responseHeader: 5s
+      overall: 10s
+    connections:
+      maxIdlePerHost: 4
+      keepAlive: 1m
+      http2: true
+    filters:
+      events:
+        allow: [" push ", pull_request]
+      paths: ["services/argo/**"]
+    transform:
+      body: "BRANCH={{.ref | trimPrefix \"refs/heads/\" | urlquery}}"
+      headers:
+        Content-Type: application/x-www-form-urlencoded
+  - url: http://jenkins.example.com/github-webhook/
+    cloudEvents:
+      mode: " Binary "
+    headers:
+      deny: [" X-Hub-Signature* "]
+      set:
+        X-Environment: prod
+`))
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+	if len(cfg.Upstreams) != 2 {
+		t.Fatalf("Parse() returned %d upstreams, want 2", len(cfg.Upstreams))
+	}
+
+	argo := cfg.Upstreams[0]
+	if argo.URL != "https://argo.example.com/hook" {
+		t.Errorf("URL = %q, want it trimmed", argo.URL)
+	}
+	if time.Duration(argo.Timeouts.Connect) != 2*time.Second || time.Duration(argo.Timeouts.Overall) != 10*time.Second {
+		t.Errorf("Timeouts = %+v, want connect 2s and overall 10s", argo.Timeouts)
+	}
+	if time.Duration(argo.Connections.KeepAlive) != time.Minute || argo.Connections.MaxIdlePerHost != 4 {
+		t.Errorf("Connections = %+v, want keepAlive 1m and maxIdlePerHost 4", argo.Connections)
+	}
+	if argo.Connections.HTTP2 == nil || !*argo.Connections.HTTP2 {
+		t.Errorf("Connections.HTTP2 = %v, want true", argo.Connections.HTTP2)
+	}
+	if cfg.Upstreams[1].Connections.HTTP2 != nil {
+		t.Errorf("Connections.HTTP2 of second upstream = %v, want unset", *cfg.Upstreams[1].Connections.HTTP2)
+	}
+
+	if deny := cfg.Filters.Events.Deny; len(deny) != 3 || deny[2] != "fork" {
+		t.Errorf("Filters.Events.Deny = %v, want [star watch fork]", deny)
+	}
+	if refs := cfg.Filters.Refs; len(refs) != 2 || !refs[1].Negated() || !refs[1].Match("refs/tags/v1") {
+		t.Errorf("Filters.Refs = %v, want [refs/heads/main !refs/tags/*]", refs)
+	}
+	if paths := argo.Filters.Paths; len(paths) != 1 || !paths.Match("services/argo/app/main.go") {
+		t.Errorf("Filters.Paths = %v, want [services/argo/**]", paths)
+	}
+	if cfg.Filters.Expression.Program == nil || argo.Filters.Expression.Program != nil {
+		t.Errorf("Filters.Expression should only be compiled for the top-level filters")
+	}
+	if allow := argo.Filters.Events.Allow; len(allow) != 2 || allow[0] != "push" {
+		t.Errorf("Filters.Events.Allow = %v, want [push pull_request]", allow)
+	}
+
+	if argo.CloudEvents.Mode != "" || cfg.Upstreams[1].CloudEvents.Mode != CloudEventsBinary {
+		t.Errorf("CloudEvents modes = %q and %q, want none and binary", argo.CloudEvents.Mode, cfg.Upstreams[1].CloudEvents.Mode)
+	}
+
+	jenkinsHeaders := cfg.Upstreams[1].Headers
+	if len(jenkinsHeaders.Deny) != 1 || jenkinsHeaders.Deny[0] != "X-Hub-Signature*" || jenkinsHeaders.Set["X-Environment"] != "prod" {
+		t.Errorf("Headers = %+v, want the trimmed deny list and the static header", jenkinsHeaders)
+	}
+
+	transform := argo.Transform
+	if body, err := transform.Body.Execute(map[string]interface{}{"ref": "refs/heads/feature/a b"}, nil); err != nil || body != "BRANCH=feature%2Fa+b" {
+		t.Errorf("Transform.Body.Execute() = %q, %v, want BRANCH=feature%%2Fa+b", body, err)
+	}
+	if header := transform.Headers["Content-Type"]; header.String() != "application/x-www-form-urlencoded" {
+		t.Errorf("Transform.Headers = %v", transform.Headers)
+	}
+
+	if len(cfg.Coalesce) != 1 || time.Duration(cfg.Coalesce[0].Window) != time.Minute {
+		t.Errorf("Coalesce = %+v, want a 1m window", cfg.Coalesce)
+	}
+
+	if len(cfg.RateLimits) != 2 {
+		t.Fatalf("RateLimits = %+v, want 2 rules", cfg.RateLimits)
+	}
+	jenkinsLimits := cfg.RateLimits[0]
+	if !jenkinsLimits.Paths.Match("/jenkins/github-webhook/") || !jenkinsLimits.TrustForwardedFor ||
+		jenkinsLimits.Repository.PerMinute != 10 || jenkinsLimits.Repository.Burst != 5 ||
+		time.Duration(jenkinsLimits.Repository.Wait) != 30*time.Second || jenkinsLimits.IP.Enabled() {
+		t.Errorf("RateLimits[0] = %+v", jenkinsLimits)
+	}
+	if !cfg.RateLimits[1].IP.Enabled() || len(cfg.RateLimits[1].Paths) != 0 {
+		t.Errorf("RateLimits[1] = %+v, want an IP limit for every path", cfg.RateLimits[1])
+	}
+
+	urls := cfg.UpstreamURLs()
+	if len(urls) != 2 || urls[1] != "http://jenkins.example.com/github-webhook/" {
+		t.Errorf("UpstreamURLs() = %v", urls)
+	}
+}
+
+func TestParseInvalid(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+	}{
+		{"EmptyURL", "upstreams:\n  - url: ''\n"},
+		{"URLWithoutScheme", "upstreams:\n  - url: jenkins.example.com\n"},
+		{"DuplicateURL", "upstreams:\n  - url: http://a\n  - url: http://a\n"},
+		{"InvalidDuration", "upstreams:\n  - url: http://a\n    timeouts:\n      overall: soon\n"},
+		{"NegativeDuration", "upstreams:\n  - url: http://a\n    timeouts:\n      connect: -1s\n"},
+		{"UnknownField", "upstreams:\n  - url: http://a\n    timeout: 1s\n"},
+		{"EmptyEventFilter", "filters:\n  events:\n    deny: ['']\n"},
+		{"InvalidRefPattern", "filters:\n  refs: ['regex:(']\n"},
+		{"InvalidExpression", "filters:\n  expression: event ==\n"},
+		{"UnknownExpressionVariable", "filters:\n  expression: sender == 'bot'\n"},
+		{"EmptySkipCIMarker", "filters:\n  skipCI:\n    markers: ['']\n"},
+		{"CoalesceWithoutWindow", "coalesce:\n  - paths: ['/ci/**']\n"},
+		{"NegativeRateLimit", "rateLimits:\n  - upstream:\n      perMinute: -1\n"},
+		{"EmptyHeaderName", "upstreams:\n  - url: http://a\n    headers:\n      allow: ['']\n"},
+		{"InvalidURLTemplate", "upstreams:\n  - url: 'http://a/{{.ref'\n"},
+		{"InvalidTemplate", "upstreams:\n  - url: http://a\n    transform:\n      body: '{{.ref'\n"},
+		{"TransformedCloudEvents", "upstreams:\n  - url: http://a\n    cloudEvents:\n      mode: binary\n    transform:\n      body: '{{.ref}}'\n"},
+		{"UnknownCloudEventsMode", "upstreams:\n  - url: http://a\n    cloudEvents:\n      mode: batched\n"},
+		{"EmptyUpstreamEventFilter", "upstreams:\n  - url: http://a\n    filters:\n      events:\n        allow: [push, ' ']\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := Parse([]byte(tt.data)); err == nil {
+				t.Errorf("Parse() error = nil, want an error")
+			}
+		})
+	}
+}
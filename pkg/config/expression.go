@@ -0,0 +1,39 @@
+package config
+
+import (
+	"fmt"
+
+	"github.com/stakater/GitWebhookProxy/pkg/expr"
+)
+
+// ExpressionVariables are the variables filter expressions can use: the event
+// type, the provider name, the decoded JSON payload, the request headers and
+// the provider independent view of the hook
+var ExpressionVariables = []string{"event", "provider", "payload", "headers", "normalized"}
+
+// Expression is a filter expression compiled when the configuration is loaded
+type Expression struct {
+	*expr.Program
+}
+
+// UnmarshalYAML implements yaml.Unmarshaler
+func (e *Expression) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var source string
+	if err := unmarshal(&source); err != nil {
+		return err
+	}
+	program, err := expr.Compile(source, ExpressionVariables)
+	if err != nil {
+		return fmt.Errorf("expression '%s' is invalid: %s", source, err)
+	}
+	e.Program = program
+	return nil
+}
+
+// MarshalYAML implements yaml.Marshaler
+func (e Expression) MarshalYAML() (interface{}, error) {
+	if e.Program == nil {
+		return "", nil
+	}
+	return e.Program.String(), nil
+}
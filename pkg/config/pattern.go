@@ -0,0 +1,135 @@
+package config
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+const (
+	regexPrefix  = "regex:"
+	negatePrefix = "!"
+)
+
+// Pattern matches strings like refs or file paths. It is a glob where `*`
+// matches within a path segment and `**` across segments, or a regular
+// expression when prefixed with "regex:". A leading "!" negates it.
+type Pattern struct {
+	source string
+	negate bool
+	re     *regexp.Regexp
+}
+
+// ParsePattern compiles a glob or "regex:" pattern
+func ParsePattern(source string) (Pattern, error) {
+	source = strings.TrimSpace(source)
+	pattern := Pattern{source: source}
+
+	expression := source
+	if strings.HasPrefix(expression, negatePrefix) {
+		pattern.negate = true
+		expression = strings.TrimPrefix(expression, negatePrefix)
+	}
+	if len(expression) == 0 {
+		return Pattern{}, fmt.Errorf("pattern '%s' is empty", source)
+	}
+
+	if strings.HasPrefix(expression, regexPrefix) {
+		expression = strings.TrimPrefix(expression, regexPrefix)
+	} else {
+		expression = globToRegexp(expression)
+	}
+	re, err := regexp.Compile(expression)
+	if err != nil {
+		return Pattern{}, fmt.Errorf("pattern '%s' is invalid: %s", source, err)
+	}
+	pattern.re = re
+	return pattern, nil
+}
+
+// globToRegexp translates a glob into an anchored regular expression
+func globToRegexp(glob string) string {
+	var expression strings.Builder
+	expression.WriteString("^")
+	for i := 0; i < len(glob); i++ {
+		switch c := glob[i]; c {
+		case '*':
+			if i+1 < len(glob) && glob[i+1] == '*' {
+				i++
+				if i+1 < len(glob) && glob[i+1] == '/' {
+					// "**/" also matches no directory at all
+					i++
+					expression.WriteString("(.*/)?")
+				} else {
+					expression.WriteString(".*")
+				}
+			} else {
+				expression.WriteString("[^/]*")
+			}
+		case '?':
+			expression.WriteString("[^/]")
+		default:
+			expression.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+	expression.WriteString("$")
+	return expression.String()
+}
+
+// Match reports whether value matches the pattern, ignoring negation
+func (p Pattern) Match(value string) bool {
+	return p.re != nil && p.re.MatchString(value)
+}
+
+// Negated reports whether the pattern started with "!"
+func (p Pattern) Negated() bool {
+	return p.negate
+}
+
+func (p Pattern) String() string {
+	return p.source
+}
+
+// UnmarshalYAML implements yaml.Unmarshaler
+func (p *Pattern) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var source string
+	if err := unmarshal(&source); err != nil {
+		return err
+	}
+	parsed, err := ParsePattern(source)
+	if err != nil {
+		return err
+	}
+	*p = parsed
+	return nil
+}
+
+// MarshalYAML implements yaml.Marshaler
+func (p Pattern) MarshalYAML() (interface{}, error) {
+	return p.source, nil
+}
+
+// Patterns is a list of patterns where negated ones exclude values
+type Patterns []Pattern
+
+// Match reports whether value matches at least one pattern that is not
+// negated, or there are only negated ones, and none of the negated ones
+func (ps Patterns) Match(value string) bool {
+	included := true
+	for _, p := range ps {
+		if !p.Negated() {
+			included = false
+			break
+		}
+	}
+	for _, p := range ps {
+		if !p.Match(value) {
+			continue
+		}
+		if p.Negated() {
+			return false
+		}
+		included = true
+	}
+	return included
+}
@@ -0,0 +1,79 @@
+package config
+
+import "testing"
+
+func TestParsePattern(t *testing.T) {
+	tests := []struct {
+		pattern string
+		value   string
+		want    bool
+	}{
+		{"refs/heads/main", "refs/heads/main", true},
+		{"refs/heads/main", "refs/heads/main2", false},
+		{"refs/heads/release/*", "refs/heads/release/1.0", true},
+		{"refs/heads/release/*", "refs/heads/release/1.0/hotfix", false},
+		{"refs/heads/release/**", "refs/heads/release/1.0/hotfix", true},
+		{"services/**/*.go", "services/main.go", true},
+		{"services/**/*.go", "services/payments/api/main.go", true},
+		{"services/**/*.go", "services/payments/README.md", false},
+		{"v?.0", "v1.0", true},
+		{"a.b", "axb", false},
+		{"!refs/tags/*", "refs/tags/v1", true},
+		{"regex:^refs/heads/(main|develop)$", "refs/heads/develop", true},
+		{"regex:^refs/heads/(main|develop)$", "refs/heads/feature", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.pattern+"/"+tt.value, func(t *testing.T) {
+			p, err := ParsePattern(tt.pattern)
+			if err != nil {
+				t.Fatalf("ParsePattern() error = %v", err)
+			}
+			if got := p.Match(tt.value); got != tt.want {
+				t.Errorf("Match(%q) = %v, want %v", tt.value, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParsePatternInvalid(t *testing.T) {
+	for _, pattern := range []string{"", "!", " ! ", "regex:(", "!regex:[a-"} {
+		if _, err := ParsePattern(pattern); err == nil {
+			t.Errorf("ParsePattern(%q) error = nil, want an error", pattern)
+		}
+	}
+}
+
+func TestPatterns_Match(t *testing.T) {
+	mustParse := func(sources ...string) Patterns {
+		patterns := Patterns{}
+		for _, source := range sources {
+			p, err := ParsePattern(source)
+			if err != nil {
+				t.Fatal(err)
+			}
+			patterns = append(patterns, p)
+		}
+		return patterns
+	}
+
+	tests := []struct {
+		name     string
+		patterns Patterns
+		value    string
+		want     bool
+	}{
+		{"Empty", mustParse(), "refs/heads/main", true},
+		{"Included", mustParse("refs/heads/main", "refs/heads/release/*"), "refs/heads/release/2", true},
+		{"NotIncluded", mustParse("refs/heads/main"), "refs/heads/feature", false},
+		{"OnlyNegated", mustParse("!refs/tags/*"), "refs/heads/feature", true},
+		{"Excluded", mustParse("!refs/tags/*"), "refs/tags/v1", false},
+		{"ExcludedWins", mustParse("refs/heads/**", "!refs/heads/wip/*"), "refs/heads/wip/x", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.patterns.Match(tt.value); got != tt.want {
+				t.Errorf("Match(%q) = %v, want %v", tt.value, got, tt.want)
+			}
+		})
+	}
+}
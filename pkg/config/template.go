@@ -0,0 +1,194 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"text/template"
+	"text/template/parse"
+)
+
+// templateFuncs are available to every template. Functions taking the value
+// to transform last can be used in pipelines, e.g. {{.ref | trimPrefix "refs/heads/"}}.
+var templateFuncs = template.FuncMap{
+	"trimPrefix": func(prefix string, s string) string { return strings.TrimPrefix(s, prefix) },
+	"trimSuffix": func(suffix string, s string) string { return strings.TrimSuffix(s, suffix) },
+	"replace":    func(old string, new string, s string) string { return strings.Replace(s, old, new, -1) },
+	"lower":      strings.ToLower,
+	"upper":      strings.ToUpper,
+	"json":       templateJSON,
+	"default":    templateDefault,
+	// Appended to every action of URL templates, see ParseURLTemplate
+	urlPathEscapeFunc:  templateEscape(url.PathEscape),
+	urlQueryEscapeFunc: templateEscape(url.QueryEscape),
+}
+
+const (
+	urlPathEscapeFunc  = "_urlPathEscape"
+	urlQueryEscapeFunc = "_urlQueryEscape"
+)
+
+// TemplateHookFuncs are the functions that read the hook being delivered:
+// header(name), event(), provider() and normalized(). They are bound with
+// Template.Execute.
+var TemplateHookFuncs = []string{"header", "event", "provider", "normalized"}
+
+var errUnboundTemplateFunc = errors.New("only available while a hook is delivered")
+
+// Template is a text/template parsed when the configuration is loaded. It is
+// executed with the decoded JSON payload as data, so {{.ref}} is the ref of
+// a push. Missing fields fail the execution; use index for optional ones,
+// e.g. {{index . "pull_request"}}.
+type Template struct {
+	source string
+	tmpl   *template.Template
+}
+
+// ParseTemplate parses a template, see Template
+func ParseTemplate(source string) (Template, error) {
+	funcs := template.FuncMap{}
+	for name, fn := range templateFuncs {
+		funcs[name] = fn
+	}
+	for _, name := range TemplateHookFuncs {
+		funcs[name] = func(...interface{}) (interface{}, error) { return nil, errUnboundTemplateFunc }
+	}
+	tmpl, err := template.New("template").Funcs(funcs).Option("missingkey=error").Parse(source)
+	if err != nil {
+		return Template{}, err
+	}
+	return Template{source: source, tmpl: tmpl}, nil
+}
+
+// ParseURLTemplate parses a template for a URL. The output of every action
+// is escaped for its place in the URL: as a path segment before the '?' and
+// as a query value after it, so that a payload field cannot add path
+// segments or query parameters.
+func ParseURLTemplate(source string) (Template, error) {
+	t, err := ParseTemplate(source)
+	if err != nil {
+		return Template{}, err
+	}
+	escapeActions(t.tmpl.Tree, t.tmpl.Tree.Root, false)
+	return t, nil
+}
+
+// IsURLTemplate tells URLs with placeholders from plain URLs
+func IsURLTemplate(source string) bool {
+	return strings.Contains(source, "{{")
+}
+
+// escapeActions appends the escaping function to the pipeline of every
+// action in list. It returns whether the query has started after the list.
+func escapeActions(tree *parse.Tree, list *parse.ListNode, inQuery bool) bool {
+	if list == nil {
+		return inQuery
+	}
+	for _, node := range list.Nodes {
+		switch node := node.(type) {
+		case *parse.TextNode:
+			inQuery = inQuery || bytes.ContainsRune(node.Text, '?')
+		case *parse.ActionNode:
+			// Actions that only declare variables print nothing
+			if len(node.Pipe.Decl) > 0 {
+				continue
+			}
+			escape := urlPathEscapeFunc
+			if inQuery {
+				escape = urlQueryEscapeFunc
+			}
+			node.Pipe.Cmds = append(node.Pipe.Cmds, &parse.CommandNode{
+				NodeType: parse.NodeCommand,
+				Pos:      node.Pos,
+				Args:     []parse.Node{parse.NewIdentifier(escape).SetTree(tree).SetPos(node.Pos)},
+			})
+		case *parse.IfNode:
+			inQuery = escapeBranch(tree, &node.BranchNode, inQuery)
+		case *parse.RangeNode:
+			inQuery = escapeBranch(tree, &node.BranchNode, inQuery)
+		case *parse.WithNode:
+			inQuery = escapeBranch(tree, &node.BranchNode, inQuery)
+		}
+	}
+	return inQuery
+}
+
+func escapeBranch(tree *parse.Tree, branch *parse.BranchNode, inQuery bool) bool {
+	afterList := escapeActions(tree, branch.List, inQuery)
+	afterElse := escapeActions(tree, branch.ElseList, inQuery)
+	return afterList || afterElse
+}
+
+// Empty is true for templates that were not configured
+func (t Template) Empty() bool {
+	return t.tmpl == nil
+}
+
+// String returns the source of the template
+func (t Template) String() string {
+	return t.source
+}
+
+// Execute renders the template for data, with hookFuncs bound to the
+// functions listed in TemplateHookFuncs
+func (t Template) Execute(data interface{}, hookFuncs template.FuncMap) (string, error) {
+	if t.tmpl == nil {
+		return "", nil
+	}
+	tmpl, err := t.tmpl.Clone()
+	if err != nil {
+		return "", err
+	}
+	var out bytes.Buffer
+	if err := tmpl.Funcs(hookFuncs).Execute(&out, data); err != nil {
+		return "", err
+	}
+	return out.String(), nil
+}
+
+// UnmarshalYAML implements yaml.Unmarshaler
+func (t *Template) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var source string
+	if err := unmarshal(&source); err != nil {
+		return err
+	}
+	parsed, err := ParseTemplate(source)
+	if err != nil {
+		return fmt.Errorf("template '%s' is invalid: %s", source, err)
+	}
+	*t = parsed
+	return nil
+}
+
+// MarshalYAML implements yaml.Marshaler
+func (t Template) MarshalYAML() (interface{}, error) {
+	return t.source, nil
+}
+
+func templateJSON(value interface{}) (string, error) {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
+
+func templateEscape(escape func(string) string) func(interface{}) string {
+	return func(value interface{}) string {
+		return escape(fmt.Sprint(value))
+	}
+}
+
+// templateDefault returns value, or def when value is missing or empty
+func templateDefault(def interface{}, value interface{}) interface{} {
+	if value == nil {
+		return def
+	}
+	if s, ok := value.(string); ok && len(s) == 0 {
+		return def
+	}
+	return value
+}
@@ -0,0 +1,67 @@
+package config
+
+import (
+	"testing"
+	"text/template"
+)
+
+func TestTemplate_Execute(t *testing.T) {
+	data := map[string]interface{}{
+		"ref":      "refs/heads/main",
+		"commits":  []interface{}{map[string]interface{}{"id": "a"}},
+		"empty":    "",
+		"deleted":  false,
+		"nullable": nil,
+	}
+	tests := []struct {
+		name   string
+		source string
+		want   string
+	}{
+		{"Field", "{{.ref}}", "refs/heads/main"},
+		{"TrimPrefix", `{{.ref | trimPrefix "refs/heads/"}}`, "main"},
+		{"TrimSuffixUpper", `{{.ref | trimSuffix "main" | upper}}`, "REFS/HEADS/"},
+		{"Replace", `{{.ref | replace "/" "-"}}`, "refs-heads-main"},
+		{"JSON", "{{json .commits}}", `[{"id":"a"}]`},
+		{"Default", `{{.empty | default "none"}}/{{.nullable | default "none"}}/{{.deleted | default true}}`, "none/none/false"},
+		{"OptionalField", `{{with index . "pull_request"}}pr{{else}}push{{end}}`, "push"},
+		{"HookFunc", `{{header "X-GitHub-Event"}}`, "push"},
+	}
+	hookFuncs := template.FuncMap{"header": func(name string) string { return "push" }}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tmpl, err := ParseTemplate(tt.source)
+			if err != nil {
+				t.Fatalf("ParseTemplate() error = %v", err)
+			}
+			got, err := tmpl.Execute(data, hookFuncs)
+			if err != nil {
+				t.Fatalf("Execute() error = %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("Execute() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTemplate_ExecuteErrors(t *testing.T) {
+	tests := []struct {
+		name   string
+		source string
+	}{
+		{"MissingField", "{{.repository.name}}"},
+		{"UnboundHookFunc", "{{event}}"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tmpl, err := ParseTemplate(tt.source)
+			if err != nil {
+				t.Fatalf("ParseTemplate() error = %v", err)
+			}
+			if _, err := tmpl.Execute(map[string]interface{}{}, nil); err == nil {
+				t.Errorf("Execute() error = nil, want an error")
+			}
+		})
+	}
+}
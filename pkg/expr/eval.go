@@ -0,0 +1,286 @@
+package expr
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+type function struct {
+	arity int
+	call  func(call *callNode, args []interface{}) (interface{}, error)
+}
+
+var functions = map[string]*function{
+	"contains": {arity: 2, call: func(call *callNode, args []interface{}) (interface{}, error) {
+		return contains(args[0], args[1])
+	}},
+	"startsWith": {arity: 2, call: func(call *callNode, args []interface{}) (interface{}, error) {
+		s, prefix, err := twoStrings("startsWith", args)
+		return err == nil && strings.HasPrefix(s, prefix), err
+	}},
+	"endsWith": {arity: 2, call: func(call *callNode, args []interface{}) (interface{}, error) {
+		s, suffix, err := twoStrings("endsWith", args)
+		return err == nil && strings.HasSuffix(s, suffix), err
+	}},
+	"matches": {arity: 2, call: func(call *callNode, args []interface{}) (interface{}, error) {
+		if args[0] == nil {
+			return false, nil
+		}
+		s, ok := args[0].(string)
+		if !ok {
+			return nil, fmt.Errorf("matches() expects a string, got %s", typeName(args[0]))
+		}
+		return call.re.MatchString(s), nil
+	}},
+	"lower": {arity: 1, call: func(call *callNode, args []interface{}) (interface{}, error) {
+		if args[0] == nil {
+			return nil, nil
+		}
+		s, ok := args[0].(string)
+		if !ok {
+			return nil, fmt.Errorf("lower() expects a string, got %s", typeName(args[0]))
+		}
+		return strings.ToLower(s), nil
+	}},
+	"size": {arity: 1, call: func(call *callNode, args []interface{}) (interface{}, error) {
+		switch value := args[0].(type) {
+		case nil:
+			return float64(0), nil
+		case string:
+			return float64(len(value)), nil
+		case []interface{}:
+			return float64(len(value)), nil
+		case map[string]interface{}:
+			return float64(len(value)), nil
+		}
+		return nil, fmt.Errorf("size() expects a string, list or object, got %s", typeName(args[0]))
+	}},
+}
+
+func (n *literalNode) eval(env map[string]interface{}) (interface{}, error) {
+	return n.value, nil
+}
+
+func (n *listNode) eval(env map[string]interface{}) (interface{}, error) {
+	list := make([]interface{}, 0, len(n.items))
+	for _, item := range n.items {
+		value, err := item.eval(env)
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, value)
+	}
+	return list, nil
+}
+
+func (n *variableNode) eval(env map[string]interface{}) (interface{}, error) {
+	return env[n.name], nil
+}
+
+// Missing fields evaluate to null, so that optional fields can be tested
+// without checking every parent first
+func (n *memberNode) eval(env map[string]interface{}) (interface{}, error) {
+	target, err := n.target.eval(env)
+	if err != nil {
+		return nil, err
+	}
+	return lookup(target, n.name), nil
+}
+
+func (n *indexNode) eval(env map[string]interface{}) (interface{}, error) {
+	target, err := n.target.eval(env)
+	if err != nil {
+		return nil, err
+	}
+	index, err := n.index.eval(env)
+	if err != nil {
+		return nil, err
+	}
+	switch key := index.(type) {
+	case string:
+		return lookup(target, key), nil
+	case float64:
+		if list, ok := target.([]interface{}); ok && key >= 0 && int(key) < len(list) && float64(int(key)) == key {
+			return list[int(key)], nil
+		}
+		return nil, nil
+	}
+	return nil, fmt.Errorf("cannot index with %s", typeName(index))
+}
+
+func lookup(target interface{}, name string) interface{} {
+	switch object := target.(type) {
+	case map[string]interface{}:
+		return object[name]
+	case map[string]string:
+		if value, ok := object[name]; ok {
+			return value
+		}
+	}
+	return nil
+}
+
+func (n *notNode) eval(env map[string]interface{}) (interface{}, error) {
+	value, err := n.operand.eval(env)
+	if err != nil {
+		return nil, err
+	}
+	b, err := toBool(value)
+	return !b, err
+}
+
+func (n *binaryNode) eval(env map[string]interface{}) (interface{}, error) {
+	left, err := n.left.eval(env)
+	if err != nil {
+		return nil, err
+	}
+
+	if n.op == "&&" || n.op == "||" {
+		b, err := toBool(left)
+		if err != nil {
+			return nil, err
+		}
+		if (n.op == "&&" && !b) || (n.op == "||" && b) {
+			return b, nil
+		}
+		right, err := n.right.eval(env)
+		if err != nil {
+			return nil, err
+		}
+		return toBool(right)
+	}
+
+	right, err := n.right.eval(env)
+	if err != nil {
+		return nil, err
+	}
+	switch n.op {
+	case "==":
+		return equal(left, right), nil
+	case "!=":
+		return !equal(left, right), nil
+	case "in":
+		return contains(right, left)
+	}
+	return compare(n.op, left, right)
+}
+
+func (n *callNode) eval(env map[string]interface{}) (interface{}, error) {
+	args := make([]interface{}, 0, len(n.args))
+	for _, arg := range n.args {
+		value, err := arg.eval(env)
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, value)
+	}
+	return n.function.call(n, args)
+}
+
+// toBool treats null as false so that `!payload.pull_request.draft` holds
+// when the field is missing
+func toBool(value interface{}) (bool, error) {
+	switch b := value.(type) {
+	case nil:
+		return false, nil
+	case bool:
+		return b, nil
+	}
+	return false, fmt.Errorf("expected a boolean, got %s", typeName(value))
+}
+
+func equal(left, right interface{}) bool {
+	return reflect.DeepEqual(left, right)
+}
+
+// contains reports whether container holds value: an item of a list, a key
+// of an object or a substring of a string
+func contains(container, value interface{}) (bool, error) {
+	switch c := container.(type) {
+	case nil:
+		return false, nil
+	case []interface{}:
+		for _, item := range c {
+			if equal(item, value) {
+				return true, nil
+			}
+		}
+		return false, nil
+	case map[string]interface{}:
+		key, ok := value.(string)
+		_, exists := c[key]
+		return ok && exists, nil
+	case string:
+		s, ok := value.(string)
+		if !ok {
+			return false, fmt.Errorf("cannot search a string for %s", typeName(value))
+		}
+		return strings.Contains(c, s), nil
+	}
+	return false, fmt.Errorf("cannot search in %s", typeName(container))
+}
+
+func compare(op string, left, right interface{}) (interface{}, error) {
+	var cmp int
+	switch l := left.(type) {
+	case float64:
+		r, ok := right.(float64)
+		if !ok {
+			return nil, fmt.Errorf("cannot compare number with %s", typeName(right))
+		}
+		if l < r {
+			cmp = -1
+		} else if l > r {
+			cmp = 1
+		}
+	case string:
+		r, ok := right.(string)
+		if !ok {
+			return nil, fmt.Errorf("cannot compare string with %s", typeName(right))
+		}
+		cmp = strings.Compare(l, r)
+	case nil:
+		// Ordering against a missing field never holds
+		return false, nil
+	default:
+		return nil, fmt.Errorf("cannot compare %s", typeName(left))
+	}
+
+	switch op {
+	case "<":
+		return cmp < 0, nil
+	case "<=":
+		return cmp <= 0, nil
+	case ">":
+		return cmp > 0, nil
+	}
+	return cmp >= 0, nil
+}
+
+func twoStrings(name string, args []interface{}) (string, string, error) {
+	first, ok1 := args[0].(string)
+	second, ok2 := args[1].(string)
+	if args[0] != nil && (!ok1 || !ok2) {
+		return "", "", fmt.Errorf("%s() expects two strings", name)
+	}
+	return first, second, nil
+}
+
+func typeName(value interface{}) string {
+	switch value.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case float64:
+		return "number"
+	case string:
+		return "string"
+	case []interface{}:
+		return "list"
+	case map[string]interface{}, map[string]string:
+		return "object"
+	}
+	return fmt.Sprintf("%T", value)
+}
@@ -0,0 +1,65 @@
+// Package expr implements the small expression language of the proxy's
+// filters, e.g.
+//
+//	event == "pull_request" && payload.action in ["opened", "synchronize"] && !payload.pull_request.draft
+//
+// Values are those of decoded JSON: null, booleans, numbers, strings, lists
+// and objects. Fields missing from an object evaluate to null, and null is
+// false where a boolean is expected.
+//
+// Operators, from lowest to highest precedence: ||, &&, !, then the
+// comparisons ==, !=, <, <=, >, >= and in. Functions: contains(container,
+// value), startsWith(s, prefix), endsWith(s, suffix), matches(s, "regexp"),
+// lower(s) and size(value).
+package expr
+
+import (
+	"fmt"
+)
+
+// Program is a compiled expression
+type Program struct {
+	source string
+	root   node
+}
+
+// Compile parses source, allowing only the given variable names. Syntax
+// errors, unknown variables and functions, and invalid matches() patterns
+// are reported here rather than on evaluation.
+func Compile(source string, variables []string) (*Program, error) {
+	tokens, err := tokenize(source)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &parser{tokens: tokens, variables: make(map[string]bool)}
+	for _, variable := range variables {
+		p.variables[variable] = true
+	}
+	root, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if p.peek().kind != tokenEOF {
+		return nil, p.unexpected("expected end of expression")
+	}
+	return &Program{source: source, root: root}, nil
+}
+
+// Eval evaluates the program against the values of its variables. The
+// result must be a boolean, null is treated as false.
+func (p *Program) Eval(env map[string]interface{}) (bool, error) {
+	value, err := p.root.eval(env)
+	if err != nil {
+		return false, err
+	}
+	result, err := toBool(value)
+	if err != nil {
+		return false, fmt.Errorf("expression did not evaluate to a boolean: %s", err)
+	}
+	return result, nil
+}
+
+func (p *Program) String() string {
+	return p.source
+}
@@ -0,0 +1,114 @@
+package expr
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+var testVariables = []string{"event", "payload", "headers"}
+
+func testEnv(t *testing.T) map[string]interface{} {
+	var payload interface{}
+	err := json.Unmarshal([]byte(`{
+		"action": "synchronize",
+		"number": 42,
+		"labels": ["deploy", "backend"],
+		"pull_request": {"draft": false, "title": "Fix 'quotes' in WIP"},
+		"commits": [{"message": "first"}, {"message": "[skip ci] second"}]
+	}`), &payload)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return map[string]interface{}{
+		"event":   "pull_request",
+		"payload": payload,
+		"headers": map[string]string{"X-Github-Event": "pull_request"},
+	}
+}
+
+func TestProgram_Eval(t *testing.T) {
+	tests := []struct {
+		source string
+		want   bool
+	}{
+		{`event == "pull_request" && payload.action in ["opened","synchronize"] && !payload.pull_request.draft`, true},
+		{`event == 'push' || payload.number > 40`, true},
+		{`payload.number >= 42 && payload.number <= 42 && payload.number != 41`, true},
+		{`payload.number < 10`, false},
+		{`"deploy" in payload.labels`, true},
+		{`"frontend" in payload.labels`, false},
+		{`"draft" in payload.pull_request`, true},
+		{`"WIP" in payload.pull_request.title`, true},
+		{`contains(payload.labels, "backend")`, true},
+		{`startsWith(payload.commits[1].message, "[skip ci]")`, true},
+		{`endsWith(lower(payload.pull_request.title), "wip")`, true},
+		{`matches(payload.pull_request.title, "^Fix ")`, true},
+		{`size(payload.commits) == 2 && size(payload.action) == 11`, true},
+		{`headers["X-Github-Event"] == event`, true},
+		{`payload.missing.field == null`, true},
+		{`!payload.missing`, true},
+		{`payload.missing > 1`, false},
+		{`payload.commits[5] == null`, true},
+		{`!(event == "push" || false)`, true},
+		{`payload.pull_request.title == 'Fix \'quotes\' in WIP'`, true},
+		{`null`, false},
+	}
+	env := testEnv(t)
+	for _, tt := range tests {
+		t.Run(tt.source, func(t *testing.T) {
+			program, err := Compile(tt.source, testVariables)
+			if err != nil {
+				t.Fatalf("Compile() error = %v", err)
+			}
+			got, err := program.Eval(env)
+			if err != nil {
+				t.Fatalf("Eval() error = %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("Eval() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCompileInvalid(t *testing.T) {
+	for _, source := range []string{
+		``,
+		`event ==`,
+		`event = "push"`,
+		`unknown == 1`,
+		`payload.`,
+		`(event == "push"`,
+		`["a", "b"`,
+		`"unterminated`,
+		`event == "push" extra`,
+		`nope(event)`,
+		`startsWith(event)`,
+		`matches(event, payload.pattern)`,
+		`matches(event, "(")`,
+		`event # 1`,
+	} {
+		if _, err := Compile(source, testVariables); err == nil {
+			t.Errorf("Compile(%q) error = nil, want an error", source)
+		}
+	}
+}
+
+func TestProgram_EvalErrors(t *testing.T) {
+	env := testEnv(t)
+	for _, source := range []string{
+		`payload.action`,
+		`!payload.number`,
+		`payload.number > "a"`,
+		`payload.action && true`,
+		`1 in payload.action`,
+	} {
+		program, err := Compile(source, testVariables)
+		if err != nil {
+			t.Fatalf("Compile(%q) error = %v", source, err)
+		}
+		if _, err := program.Eval(env); err == nil {
+			t.Errorf("Eval(%q) error = nil, want an error", source)
+		}
+	}
+}
@@ -0,0 +1,128 @@
+package expr
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+type tokenKind int
+
+const (
+	tokenEOF tokenKind = iota
+	tokenIdent
+	tokenString
+	tokenNumber
+	tokenOperator
+)
+
+type token struct {
+	kind  tokenKind
+	text  string
+	value interface{}
+	pos   int
+}
+
+// operators are ordered so that longer operators are tried first
+var operators = []string{"==", "!=", "<=", ">=", "&&", "||", "<", ">", "!", "(", ")", "[", "]", ",", "."}
+
+func tokenize(source string) ([]token, error) {
+	tokens := []token{}
+	for i := 0; i < len(source); {
+		c := source[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			i++
+		case c == '"' || c == '\'':
+			text, value, err := readString(source, i)
+			if err != nil {
+				return nil, err
+			}
+			tokens = append(tokens, token{kind: tokenString, text: text, value: value, pos: i})
+			i += len(text)
+		case isDigit(c):
+			start := i
+			for i < len(source) && (isDigit(source[i]) || source[i] == '.') {
+				i++
+			}
+			value, err := strconv.ParseFloat(source[start:i], 64)
+			if err != nil {
+				return nil, fmt.Errorf("invalid number '%s' at position %d", source[start:i], start)
+			}
+			tokens = append(tokens, token{kind: tokenNumber, text: source[start:i], value: value, pos: start})
+		case isIdentStart(c):
+			start := i
+			for i < len(source) && (isIdentStart(source[i]) || isDigit(source[i])) {
+				i++
+			}
+			tokens = append(tokens, token{kind: tokenIdent, text: source[start:i], pos: start})
+		default:
+			operator := ""
+			for _, op := range operators {
+				if strings.HasPrefix(source[i:], op) {
+					operator = op
+					break
+				}
+			}
+			if len(operator) == 0 {
+				return nil, fmt.Errorf("unexpected character '%c' at position %d", c, i)
+			}
+			tokens = append(tokens, token{kind: tokenOperator, text: operator, pos: i})
+			i += len(operator)
+		}
+	}
+	return append(tokens, token{kind: tokenEOF, pos: len(source)}), nil
+}
+
+// readString reads the quoted string starting at source[start] and returns
+// its source text and unquoted value
+func readString(source string, start int) (string, string, error) {
+	quote := source[start]
+	for i := start + 1; i < len(source); i++ {
+		switch source[i] {
+		case '\\':
+			i++
+		case quote:
+			text := source[start : i+1]
+			body := text[1 : len(text)-1]
+			if quote == '\'' {
+				body = singleToDoubleQuoted(body)
+			}
+			value, err := strconv.Unquote(`"` + body + `"`)
+			if err != nil {
+				return "", "", fmt.Errorf("invalid string %s at position %d", text, start)
+			}
+			return text, value, nil
+		}
+	}
+	return "", "", fmt.Errorf("unterminated string at position %d", start)
+}
+
+// singleToDoubleQuoted rewrites the body of a single quoted string so that
+// Go's escapes for double quoted strings can be reused
+func singleToDoubleQuoted(body string) string {
+	var converted strings.Builder
+	for i := 0; i < len(body); i++ {
+		switch {
+		case body[i] == '\\' && i+1 < len(body):
+			if body[i+1] != '\'' {
+				converted.WriteByte('\\')
+			}
+			converted.WriteByte(body[i+1])
+			i++
+		case body[i] == '"':
+			converted.WriteString(`\"`)
+		default:
+			converted.WriteByte(body[i])
+		}
+	}
+	return converted.String()
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+func isIdentStart(c byte) bool {
+	return c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
@@ -0,0 +1,286 @@
+package expr
+
+import (
+	"fmt"
+	"regexp"
+)
+
+type node interface {
+	eval(env map[string]interface{}) (interface{}, error)
+}
+
+type literalNode struct {
+	value interface{}
+}
+
+type listNode struct {
+	items []node
+}
+
+type variableNode struct {
+	name string
+}
+
+// memberNode is field access like payload.action
+type memberNode struct {
+	target node
+	name   string
+}
+
+// indexNode is index access like headers["X-Github-Event"] or commits[0]
+type indexNode struct {
+	target node
+	index  node
+}
+
+type notNode struct {
+	operand node
+}
+
+type binaryNode struct {
+	op          string
+	left, right node
+}
+
+type callNode struct {
+	function *function
+	args     []node
+	// re is the compiled pattern of matches()
+	re *regexp.Regexp
+}
+
+type parser struct {
+	tokens    []token
+	pos       int
+	variables map[string]bool
+}
+
+func (p *parser) peek() token {
+	return p.tokens[p.pos]
+}
+
+func (p *parser) next() token {
+	t := p.tokens[p.pos]
+	if t.kind != tokenEOF {
+		p.pos++
+	}
+	return t
+}
+
+func (p *parser) isOperator(op string) bool {
+	t := p.peek()
+	return t.kind == tokenOperator && t.text == op
+}
+
+func (p *parser) expect(op string) error {
+	if !p.isOperator(op) {
+		return p.unexpected(fmt.Sprintf("expected '%s'", op))
+	}
+	p.next()
+	return nil
+}
+
+func (p *parser) unexpected(expected string) error {
+	t := p.peek()
+	if t.kind == tokenEOF {
+		return fmt.Errorf("%s at end of expression", expected)
+	}
+	return fmt.Errorf("%s, found '%s' at position %d", expected, t.text, t.pos)
+}
+
+func (p *parser) parseOr() (node, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for p.isOperator("||") {
+		p.next()
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = &binaryNode{op: "||", left: left, right: right}
+	}
+	return left, nil
+}
+
+func (p *parser) parseAnd() (node, error) {
+	left, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	for p.isOperator("&&") {
+		p.next()
+		right, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		left = &binaryNode{op: "&&", left: left, right: right}
+	}
+	return left, nil
+}
+
+func (p *parser) parseUnary() (node, error) {
+	if p.isOperator("!") {
+		p.next()
+		operand, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return &notNode{operand: operand}, nil
+	}
+	return p.parseComparison()
+}
+
+var comparisonOperators = map[string]bool{
+	"==": true, "!=": true, "<": true, "<=": true, ">": true, ">=": true,
+}
+
+func (p *parser) parseComparison() (node, error) {
+	left, err := p.parsePostfix()
+	if err != nil {
+		return nil, err
+	}
+	t := p.peek()
+	op := ""
+	if t.kind == tokenOperator && comparisonOperators[t.text] {
+		op = t.text
+	} else if t.kind == tokenIdent && t.text == "in" {
+		op = "in"
+	}
+	if len(op) == 0 {
+		return left, nil
+	}
+	p.next()
+	right, err := p.parsePostfix()
+	if err != nil {
+		return nil, err
+	}
+	return &binaryNode{op: op, left: left, right: right}, nil
+}
+
+func (p *parser) parsePostfix() (node, error) {
+	target, err := p.parsePrimary()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		switch {
+		case p.isOperator("."):
+			p.next()
+			t := p.next()
+			if t.kind != tokenIdent {
+				p.pos--
+				return nil, p.unexpected("expected a field name")
+			}
+			target = &memberNode{target: target, name: t.text}
+		case p.isOperator("["):
+			p.next()
+			index, err := p.parseOr()
+			if err != nil {
+				return nil, err
+			}
+			if err := p.expect("]"); err != nil {
+				return nil, err
+			}
+			target = &indexNode{target: target, index: index}
+		default:
+			return target, nil
+		}
+	}
+}
+
+func (p *parser) parsePrimary() (node, error) {
+	t := p.peek()
+	switch t.kind {
+	case tokenString, tokenNumber:
+		p.next()
+		return &literalNode{value: t.value}, nil
+	case tokenIdent:
+		p.next()
+		switch t.text {
+		case "true":
+			return &literalNode{value: true}, nil
+		case "false":
+			return &literalNode{value: false}, nil
+		case "null":
+			return &literalNode{value: nil}, nil
+		}
+		if p.isOperator("(") {
+			return p.parseCall(t)
+		}
+		if !p.variables[t.text] {
+			return nil, fmt.Errorf("unknown variable '%s' at position %d", t.text, t.pos)
+		}
+		return &variableNode{name: t.text}, nil
+	case tokenOperator:
+		switch t.text {
+		case "(":
+			p.next()
+			inner, err := p.parseOr()
+			if err != nil {
+				return nil, err
+			}
+			return inner, p.expect(")")
+		case "[":
+			p.next()
+			list := &listNode{}
+			for !p.isOperator("]") {
+				item, err := p.parseOr()
+				if err != nil {
+					return nil, err
+				}
+				list.items = append(list.items, item)
+				if !p.isOperator(",") {
+					break
+				}
+				p.next()
+			}
+			return list, p.expect("]")
+		}
+	}
+	return nil, p.unexpected("expected a value")
+}
+
+func (p *parser) parseCall(name token) (node, error) {
+	fn, ok := functions[name.text]
+	if !ok {
+		return nil, fmt.Errorf("unknown function '%s' at position %d", name.text, name.pos)
+	}
+	p.next() // (
+	call := &callNode{function: fn}
+	for !p.isOperator(")") {
+		arg, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		call.args = append(call.args, arg)
+		if !p.isOperator(",") {
+			break
+		}
+		p.next()
+	}
+	if err := p.expect(")"); err != nil {
+		return nil, err
+	}
+	if len(call.args) != fn.arity {
+		return nil, fmt.Errorf("function '%s' takes %d arguments, got %d", name.text, fn.arity, len(call.args))
+	}
+
+	if name.text == "matches" {
+		source := ""
+		pattern, ok := call.args[1].(*literalNode)
+		if ok {
+			source, ok = pattern.value.(string)
+		}
+		if !ok {
+			return nil, fmt.Errorf("the pattern of matches() must be a string literal")
+		}
+		re, err := regexp.Compile(source)
+		if err != nil {
+			return nil, fmt.Errorf("invalid pattern for matches(): %s", err)
+		}
+		call.re = re
+	}
+	return call, nil
+}
@@ -2,13 +2,26 @@ package parser
 
 import (
 	"errors"
+	"io"
 	"io/ioutil"
+	"mime"
 	"net/http"
+	"net/url"
 
 	"github.com/stakater/GitWebhookProxy/pkg/providers"
 )
 
+// ErrBodyTooLarge is returned by ParseLimited for bodies over the limit
+var ErrBodyTooLarge = errors.New("Request body is too large")
+
 func Parse(req *http.Request, provider providers.Provider) (*providers.Hook, error) {
+	return ParseLimited(req, provider, 0)
+}
+
+// ParseLimited parses a hook whose body is at most maxBodySize bytes, or of
+// any size when maxBodySize is 0. The body is read once, Hook.Payload is
+// then shared by every request forwarding the hook.
+func ParseLimited(req *http.Request, provider providers.Provider, maxBodySize int64) (*providers.Hook, error) {
 	hook := &providers.Hook{
 		Headers: make(map[string]string),
 	}
@@ -27,13 +40,50 @@ func Parse(req *http.Request, provider providers.Provider) (*providers.Hook, err
 		hook.Headers[header] = req.Header.Get(header)
 	}
 
-	if body, err := ioutil.ReadAll(req.Body); err != nil {
+	if body, err := readBody(req, maxBodySize); err != nil {
 		return nil, err
 	} else {
 		hook.Payload = body
 	}
 
+	if isFormEncoded(req.Header.Get(providers.ContentTypeHeader)) {
+		form, err := url.ParseQuery(string(hook.Payload))
+		if err != nil {
+			return nil, errors.New("Form encoded payload is invalid: " + err.Error())
+		}
+		data := form.Get(providers.FormPayloadField)
+		if len(data) == 0 {
+			return nil, errors.New("Form encoded payload has no '" + providers.FormPayloadField + "' field")
+		}
+		// Keep Payload as received so that signatures are still validated
+		// over the raw body
+		hook.Data = []byte(data)
+	}
+
 	hook.RequestMethod = req.Method
 
 	return hook, nil
 }
+
+func isFormEncoded(contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	return err == nil && mediaType == providers.FormContentTypeHeaderValue
+}
+
+func readBody(req *http.Request, maxBodySize int64) ([]byte, error) {
+	if maxBodySize <= 0 {
+		return ioutil.ReadAll(req.Body)
+	}
+	// Reject announced sizes before reading anything
+	if req.ContentLength > maxBodySize {
+		return nil, ErrBodyTooLarge
+	}
+	body, err := ioutil.ReadAll(io.LimitReader(req.Body, maxBodySize+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(body)) > maxBodySize {
+		return nil, ErrBodyTooLarge
+	}
+	return body, nil
+}
@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
 	"reflect"
 	"testing"
 
@@ -129,3 +130,63 @@ func TestParse(t *testing.T) {
 		})
 	}
 }
+
+func TestParseFormEncoded(t *testing.T) {
+	payload := `{"ref":"refs/heads/main","sender":{"login":"octocat"}}`
+	body := url.Values{providers.FormPayloadField: {payload}}.Encode()
+	provider, _ := providers.NewGithubProvider("")
+
+	req := httptest.NewRequest(http.MethodPost, "/github-webhook/", bytes.NewReader([]byte(body)))
+	req.Header.Add(providers.XGitHubEvent, "push")
+	req.Header.Add(providers.XGitHubDelivery, "1")
+	req.Header.Add(providers.ContentTypeHeader, providers.FormContentTypeHeaderValue+"; charset=utf-8")
+	hook, err := Parse(req, provider)
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+	if string(hook.Payload) != body {
+		t.Errorf("Payload = %q, want the raw body %q", hook.Payload, body)
+	}
+	if string(hook.JSON()) != payload {
+		t.Errorf("JSON() = %q, want the decoded payload field %q", hook.JSON(), payload)
+	}
+
+	req = httptest.NewRequest(http.MethodPost, "/github-webhook/", bytes.NewReader([]byte("other=1")))
+	req.Header.Add(providers.XGitHubEvent, "push")
+	req.Header.Add(providers.XGitHubDelivery, "1")
+	req.Header.Add(providers.ContentTypeHeader, providers.FormContentTypeHeaderValue)
+	if _, err := Parse(req, provider); err == nil {
+		t.Errorf("Parse() error = nil, want an error for a form without the payload field")
+	}
+}
+
+func TestParseLimited(t *testing.T) {
+	tests := []struct {
+		name          string
+		body          string
+		unknownLength bool
+		maxBodySize   int64
+		wantErr       error
+	}{
+		{"Unlimited", "0123456789", false, 0, nil},
+		{"AtLimit", "0123456789", false, 10, nil},
+		{"OverLimit", "0123456789", false, 9, ErrBodyTooLarge},
+		{"ChunkedAtLimit", "0123456789", true, 10, nil},
+		{"ChunkedOverLimit", "0123456789", true, 9, ErrBodyTooLarge},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := createGitlabRequest(http.MethodPost, "/dummy", parserGitlabTestSecret, parserGitlabTestEvent, tt.body)
+			if tt.unknownLength {
+				req.ContentLength = -1
+			}
+			hook, err := ParseLimited(req, createGitlabProvider(parserGitlabTestSecret), tt.maxBodySize)
+			if err != tt.wantErr {
+				t.Fatalf("ParseLimited() error = %v, want %v", err, tt.wantErr)
+			}
+			if err == nil && string(hook.Payload) != tt.body {
+				t.Errorf("Payload = %q, want %q", hook.Payload, tt.body)
+			}
+		})
+	}
+}
@@ -0,0 +1,41 @@
+package providers
+
+import (
+	"regexp"
+	"strings"
+)
+
+const (
+	githubBotType   = "Bot"
+	githubBotSuffix = "[bot]"
+)
+
+// gitlabBotUsername matches the users GitLab creates for project and group
+// access tokens, e.g. project_42_bot or group_7_bot_5f3a..., and its internal
+// bot users like support-bot
+var gitlabBotUsername = regexp.MustCompile(`^((project|group)_\d+_bot(_[0-9a-f]+)?|(support|alert|visual-review|security|automation)-bot)$`)
+
+// Actor is the account that triggered a hook
+type Actor struct {
+	Login string `json:"login"`
+	// Type is the GitHub account type: User, Bot or Organization
+	Type  string `json:"type,omitempty"`
+	Email string `json:"email,omitempty"`
+}
+
+// IsBot reports whether the actor is an automation account: a GitHub App
+// like dependabot[bot], or a GitLab bot user
+func (a Actor) IsBot() bool {
+	return a.Type == githubBotType ||
+		strings.HasSuffix(a.Login, githubBotSuffix) ||
+		gitlabBotUsername.MatchString(a.Login)
+}
+
+// EmailDomain returns the lower-cased domain of the actor's email, if any
+func (a Actor) EmailDomain() string {
+	at := strings.LastIndex(a.Email, "@")
+	if at < 0 {
+		return ""
+	}
+	return strings.ToLower(a.Email[at+1:])
+}
@@ -0,0 +1,35 @@
+package providers
+
+import "testing"
+
+func TestActor_IsBot(t *testing.T) {
+	tests := []struct {
+		name  string
+		actor Actor
+		want  bool
+	}{
+		{"GithubUser", Actor{Login: "octocat", Type: "User"}, false},
+		{"GithubBotType", Actor{Login: "renovate", Type: "Bot"}, true},
+		{"GithubBotSuffix", Actor{Login: "dependabot[bot]"}, true},
+		{"GitlabProjectBot", Actor{Login: "project_42_bot"}, true},
+		{"GitlabGroupBotWithSuffix", Actor{Login: "group_7_bot_5f3a9c"}, true},
+		{"GitlabSupportBot", Actor{Login: "support-bot"}, true},
+		{"GitlabUserNamedBot", Actor{Login: "robot"}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.actor.IsBot(); got != tt.want {
+				t.Errorf("IsBot() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestActor_EmailDomain(t *testing.T) {
+	if got := (Actor{Email: "ci@Services.Example.com"}).EmailDomain(); got != "services.example.com" {
+		t.Errorf("EmailDomain() = %q, want services.example.com", got)
+	}
+	if got := (Actor{}).EmailDomain(); got != "" {
+		t.Errorf("EmailDomain() of actor without email = %q, want empty", got)
+	}
+}
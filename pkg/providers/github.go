@@ -10,9 +10,12 @@ import (
 )
 
 const (
-	GithubPushEvent         Event = "push"
-	GithubPullRequestEvent  Event = "pull_request"
-	GithubIssueCommentEvent Event = "issue_comment"
+	GithubPushEvent                     Event = "push"
+	GithubPullRequestEvent              Event = "pull_request"
+	GithubIssueCommentEvent             Event = "issue_comment"
+	GithubPullRequestReviewEvent        Event = "pull_request_review"
+	GithubPullRequestReviewCommentEvent Event = "pull_request_review_comment"
+	GithubPingEvent                     Event = "ping"
 )
 
 // Header constants
@@ -78,38 +81,64 @@ func (p *GithubProvider) GetEventType(hook Hook) Event {
 	return eventType
 }
 
+// IsCommitterCheckEvent reports whether the event has an actor. Every GitHub
+// event except ping is sent on behalf of an account.
 func (p *GithubProvider) IsCommitterCheckEvent(event Event) bool {
-	return event == GithubPushEvent || event == GithubPullRequestEvent || event == GithubIssueCommentEvent
+	return len(event) > 0 && event != GithubPingEvent
 }
 
 func (p *GithubProvider) GetCommitter(hook Hook, eventType Event) string {
-	var pushPayloadData GithubPushPayload
-	var pullRequestPayloadData GithubPullRequestPayload
-	var issueCommentPayloadData GithubIssueCommentPayload
+	return p.GetActor(hook, eventType).Login
+}
+
+// githubAccount is the user or bot object of GitHub payloads
+type githubAccount struct {
+	Login string `json:"login"`
+	Type  string `json:"type"`
+}
+
+// githubActorPayload holds the fields of any GitHub payload that name its actor
+type githubActorPayload struct {
+	Sender  githubAccount `json:"sender"`
+	Comment struct {
+		User githubAccount `json:"user"`
+	} `json:"comment"`
+	Review struct {
+		User githubAccount `json:"user"`
+	} `json:"review"`
+	Pusher struct {
+		Email string `json:"email"`
+	} `json:"pusher"`
+}
+
+// GetActor returns the author of comments and reviews, and the sender of
+// every other event
+func (p *GithubProvider) GetActor(hook Hook, eventType Event) Actor {
+	var payloadData githubActorPayload
+	if err := json.Unmarshal(hook.JSON(), &payloadData); err != nil {
+		log.Printf("Github payload unmarshaling failed for %v event: %v", eventType, err)
+		return Actor{}
+	}
 
+	account := payloadData.Sender
 	switch eventType {
-	case GithubPushEvent:
-		if err := json.Unmarshal(hook.Payload, &pushPayloadData); err != nil {
-			log.Printf("Github payload unmarshaling failed for Push event: %v", err)
-			return ""
-		}
-		return pushPayloadData.Sender.Login
-	case GithubPullRequestEvent:
-		if err := json.Unmarshal(hook.Payload, &pullRequestPayloadData); err != nil {
-			log.Printf("Github payload unmarshaling failed for Pull Request event: %v", err)
-			return ""
-		}
-		return pullRequestPayloadData.Sender.Login
-	case GithubIssueCommentEvent:
-		if err := json.Unmarshal(hook.Payload, &issueCommentPayloadData); err != nil {
-			log.Printf("Github payload unmarshaling failed for issue comment event: %v", err)
-			return ""
-		}
-		return issueCommentPayloadData.Comment.User.Login
+	case GithubIssueCommentEvent, GithubPullRequestReviewCommentEvent:
+		account = payloadData.Comment.User
+	case GithubPullRequestReviewEvent:
+		account = payloadData.Review.User
+	}
+	if len(account.Login) == 0 {
+		account = payloadData.Sender
 	}
 
-	log.Printf("Event type is not supported: %v", eventType)
-	return ""
+	actor := Actor{
+		Login: account.Login,
+		Type:  account.Type,
+	}
+	if eventType == GithubPushEvent {
+		actor.Email = payloadData.Pusher.Email
+	}
+	return actor
 }
 
 // IsValidPayload checks if the github payload's hash fits with
@@ -0,0 +1,140 @@
+package providers
+
+import (
+	"encoding/json"
+)
+
+const (
+	GithubReleaseEvent     Event = "release"
+	GithubCreateEvent      Event = "create"
+	GithubDeleteEvent      Event = "delete"
+	GithubWorkflowRunEvent Event = "workflow_run"
+)
+
+var githubEventKinds = map[Event]EventKind{
+	GithubPullRequestEvent:              PullRequestEventKind,
+	GithubIssueCommentEvent:             CommentEventKind,
+	GithubPullRequestReviewEvent:        CommentEventKind,
+	GithubPullRequestReviewCommentEvent: CommentEventKind,
+	"commit_comment":                    CommentEventKind,
+	GithubReleaseEvent:                  ReleaseEventKind,
+	GithubWorkflowRunEvent:              PipelineEventKind,
+	"workflow_job":                      PipelineEventKind,
+	"check_run":                         PipelineEventKind,
+	"check_suite":                       PipelineEventKind,
+	"status":                            PipelineEventKind,
+}
+
+type githubCommit struct {
+	ID       string   `json:"id"`
+	Message  string   `json:"message"`
+	Added    []string `json:"added"`
+	Modified []string `json:"modified"`
+	Removed  []string `json:"removed"`
+}
+
+// githubNormalizedPayload holds the fields of any GitHub payload that make
+// up a NormalizedEvent
+type githubNormalizedPayload struct {
+	Ref        string         `json:"ref"`
+	RefType    string         `json:"ref_type"`
+	Before     string         `json:"before"`
+	After      string         `json:"after"`
+	Action     string         `json:"action"`
+	Commits    []githubCommit `json:"commits"`
+	HeadCommit *githubCommit  `json:"head_commit"`
+	Repository struct {
+		FullName string `json:"full_name"`
+		CloneURL string `json:"clone_url"`
+		SSHURL   string `json:"ssh_url"`
+		HTMLURL  string `json:"html_url"`
+	} `json:"repository"`
+	PullRequest struct {
+		Number int64  `json:"number"`
+		State  string `json:"state"`
+		Draft  bool   `json:"draft"`
+		Base   struct {
+			Ref string `json:"ref"`
+		} `json:"base"`
+		Head struct {
+			Ref string `json:"ref"`
+			Sha string `json:"sha"`
+		} `json:"head"`
+	} `json:"pull_request"`
+	Release struct {
+		TagName string `json:"tag_name"`
+	} `json:"release"`
+	WorkflowRun struct {
+		HeadBranch string `json:"head_branch"`
+		HeadSha    string `json:"head_sha"`
+	} `json:"workflow_run"`
+}
+
+// Normalize returns the provider independent view of a GitHub hook
+func (p *GithubProvider) Normalize(hook Hook) (*NormalizedEvent, error) {
+	eventType := p.GetEventType(hook)
+	var payloadData githubNormalizedPayload
+	if err := json.Unmarshal(hook.JSON(), &payloadData); err != nil {
+		return nil, err
+	}
+
+	event := &NormalizedEvent{
+		Provider:   GithubName,
+		Event:      eventType,
+		DeliveryID: hook.Header(XGitHubDelivery),
+		Kind:       OtherEventKind,
+		Repository: Repository{
+			FullName: payloadData.Repository.FullName,
+			CloneURL: payloadData.Repository.CloneURL,
+			SSHURL:   payloadData.Repository.SSHURL,
+			WebURL:   payloadData.Repository.HTMLURL,
+		},
+		Actor: p.GetActor(hook, eventType),
+	}
+	if kind, ok := githubEventKinds[eventType]; ok {
+		event.Kind = kind
+	}
+
+	switch eventType {
+	case GithubPushEvent:
+		event.Kind = pushKind(payloadData.Ref)
+		event.Ref = payloadData.Ref
+		event.Before = payloadData.Before
+		event.After = payloadData.After
+		for _, commit := range payloadData.Commits {
+			event.addCommit(commit.ID, commit.Message, commit.Added, commit.Modified, commit.Removed)
+		}
+		// head_commit is normally the last commit, but is sent on its own
+		// when the push only moved the ref to an existing commit
+		if head := payloadData.HeadCommit; head != nil && len(head.ID) > 0 {
+			if last := event.HeadCommit(); last == nil || last.ID != head.ID {
+				event.addCommit(head.ID, head.Message, head.Added, head.Modified, head.Removed)
+			}
+		}
+		event.dedupeChangedFiles()
+	case GithubPullRequestEvent:
+		pr := payloadData.PullRequest
+		event.Ref = branchRef(pr.Head.Ref)
+		event.After = pr.Head.Sha
+		event.PullRequest = &PullRequest{
+			Number:  pr.Number,
+			State:   pr.State,
+			Action:  payloadData.Action,
+			BaseRef: branchRef(pr.Base.Ref),
+			HeadRef: branchRef(pr.Head.Ref),
+			Draft:   pr.Draft,
+		}
+	case GithubCreateEvent, GithubDeleteEvent:
+		event.Ref = branchRef(payloadData.Ref)
+		if payloadData.RefType == "tag" {
+			event.Kind = TagEventKind
+			event.Ref = tagRef(payloadData.Ref)
+		}
+	case GithubReleaseEvent:
+		event.Ref = tagRef(payloadData.Release.TagName)
+	case GithubWorkflowRunEvent:
+		event.Ref = branchRef(payloadData.WorkflowRun.HeadBranch)
+		event.After = payloadData.WorkflowRun.HeadSha
+	}
+	return event, nil
+}
@@ -246,3 +246,87 @@ func TestGithubProvider_Validate(t *testing.T) {
 		})
 	}
 }
+
+func TestGithubProvider_GetActor(t *testing.T) {
+	tests := []struct {
+		name    string
+		event   Event
+		payload string
+		want    Actor
+	}{
+		{
+			name:    "Push",
+			event:   GithubPushEvent,
+			payload: `{"pusher":{"email":"bot@ci.example.com"},"sender":{"login":"renovate[bot]","type":"Bot"}}`,
+			want:    Actor{Login: "renovate[bot]", Type: "Bot", Email: "bot@ci.example.com"},
+		},
+		{
+			name:    "PullRequest",
+			event:   GithubPullRequestEvent,
+			payload: `{"sender":{"login":"octocat","type":"User"}}`,
+			want:    Actor{Login: "octocat", Type: "User"},
+		},
+		{
+			name:    "IssueComment",
+			event:   GithubIssueCommentEvent,
+			payload: `{"comment":{"user":{"login":"dependabot[bot]","type":"Bot"}}}`,
+			want:    Actor{Login: "dependabot[bot]", Type: "Bot"},
+		},
+		{
+			name:    "PullRequestReview",
+			event:   GithubPullRequestReviewEvent,
+			payload: `{"review":{"user":{"login":"reviewer","type":"User"}},"sender":{"login":"octocat"}}`,
+			want:    Actor{Login: "reviewer", Type: "User"},
+		},
+		{
+			name:    "PullRequestReviewComment",
+			event:   GithubPullRequestReviewCommentEvent,
+			payload: `{"comment":{"user":{"login":"reviewer","type":"User"}},"sender":{"login":"octocat"}}`,
+			want:    Actor{Login: "reviewer", Type: "User"},
+		},
+		{
+			name:    "WorkflowRunFallsBackToSender",
+			event:   "workflow_run",
+			payload: `{"workflow_run":{"actor":{"login":"ignored"}},"sender":{"login":"octocat","type":"User"}}`,
+			want:    Actor{Login: "octocat", Type: "User"},
+		},
+		{
+			name:    "Release",
+			event:   "release",
+			payload: `{"sender":{"login":"github-actions[bot]","type":"Bot"}}`,
+			want:    Actor{Login: "github-actions[bot]", Type: "Bot"},
+		},
+		{
+			name:    "InvalidPayload",
+			event:   GithubPushEvent,
+			payload: `{`,
+			want:    Actor{},
+		},
+	}
+	p := &GithubProvider{}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := p.GetActor(Hook{Payload: []byte(tt.payload)}, tt.event)
+			if got != tt.want {
+				t.Errorf("GetActor() = %+v, want %+v", got, tt.want)
+			}
+			if committer := p.GetCommitter(Hook{Payload: []byte(tt.payload)}, tt.event); committer != tt.want.Login {
+				t.Errorf("GetCommitter() = %q, want %q", committer, tt.want.Login)
+			}
+		})
+	}
+}
+
+func TestGithubProvider_IsCommitterCheckEvent(t *testing.T) {
+	p := &GithubProvider{}
+	for _, event := range []Event{GithubPushEvent, GithubPullRequestEvent, "create", "delete", "release", "workflow_run"} {
+		if !p.IsCommitterCheckEvent(event) {
+			t.Errorf("IsCommitterCheckEvent(%q) = false, want true", event)
+		}
+	}
+	for _, event := range []Event{GithubPingEvent, ""} {
+		if p.IsCommitterCheckEvent(event) {
+			t.Errorf("IsCommitterCheckEvent(%q) = true, want false", event)
+		}
+	}
+}
@@ -10,12 +10,17 @@ import (
 const (
 	XGitlabToken = "X-Gitlab-Token"
 	XGitlabEvent = "X-Gitlab-Event"
-	GitlabName   = "gitlab"
+	// XGitlabEventUUID identifies a delivery, it is only sent by GitLab 13.11 and later
+	XGitlabEventUUID = "X-Gitlab-Event-UUID"
+	GitlabName       = "gitlab"
 )
 
 const (
 	GitlabPushEvent         Event = "Push Hook"
+	GitlabTagPushEvent      Event = "Tag Push Hook"
 	GitlabMergeRequestEvent Event = "Merge Request Hook"
+	GitlabNoteEvent         Event = "Note Hook"
+	GitlabPipelineEvent     Event = "Pipeline Hook"
 )
 
 type GitlabProvider struct {
@@ -66,19 +71,42 @@ func (p *GitlabProvider) GetEventType(hook Hook) Event {
 	return event
 }
 
+// IsCommitterCheckEvent reports whether the event has an actor. GitLab names
+// the user in every event type, except some system hooks.
 func (p *GitlabProvider) IsCommitterCheckEvent(event Event) bool {
-	return event == GitlabPushEvent
+	return len(event) > 0
 }
 
 func (p *GitlabProvider) GetCommitter(hook Hook, eventType Event) string {
-	var payloadData GitlabPushPayload
-	if err := json.Unmarshal(hook.Payload, &payloadData); err != nil {
+	return p.GetActor(hook, eventType).Login
+}
+
+// gitlabActorPayload holds the fields of any GitLab payload that name its
+// actor. Push and tag push hooks use the flat user_* fields, the others a
+// user object.
+type gitlabActorPayload struct {
+	Username string `json:"user_username"`
+	Email    string `json:"user_email"`
+	User     struct {
+		Username string `json:"username"`
+		Email    string `json:"email"`
+	} `json:"user"`
+}
+
+func (p *GitlabProvider) GetActor(hook Hook, eventType Event) Actor {
+	var payloadData gitlabActorPayload
+	if err := json.Unmarshal(hook.JSON(), &payloadData); err != nil {
 		log.Printf("Gitlab hook payload unmarshalling failed")
-		return ""
+		return Actor{}
+	}
+	if len(payloadData.Username) > 0 {
+		return Actor{
+			Login: payloadData.Username,
+			Email: payloadData.Email,
+		}
 	}
-	switch eventType {
-	case GitlabPushEvent:
-		return payloadData.Username
+	return Actor{
+		Login: payloadData.User.Username,
+		Email: payloadData.User.Email,
 	}
-	return ""
 }
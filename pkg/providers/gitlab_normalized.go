@@ -0,0 +1,118 @@
+package providers
+
+import (
+	"encoding/json"
+)
+
+const (
+	GitlabReleaseEvent Event = "Release Hook"
+	GitlabJobEvent     Event = "Job Hook"
+)
+
+var gitlabEventKinds = map[Event]EventKind{
+	GitlabPushEvent:         PushEventKind,
+	GitlabTagPushEvent:      TagEventKind,
+	GitlabMergeRequestEvent: PullRequestEventKind,
+	GitlabNoteEvent:         CommentEventKind,
+	GitlabReleaseEvent:      ReleaseEventKind,
+	GitlabPipelineEvent:     PipelineEventKind,
+	GitlabJobEvent:          PipelineEventKind,
+}
+
+// gitlabNormalizedPayload holds the fields of any GitLab payload that make
+// up a NormalizedEvent
+type gitlabNormalizedPayload struct {
+	Ref     string `json:"ref"`
+	Before  string `json:"before"`
+	After   string `json:"after"`
+	Tag     string `json:"tag"`
+	Commits []struct {
+		ID       string   `json:"id"`
+		Message  string   `json:"message"`
+		Added    []string `json:"added"`
+		Modified []string `json:"modified"`
+		Removed  []string `json:"removed"`
+	} `json:"commits"`
+	Project struct {
+		PathWithNamespace string `json:"path_with_namespace"`
+		GitHTTPURL        string `json:"git_http_url"`
+		GitSSHURL         string `json:"git_ssh_url"`
+		WebURL            string `json:"web_url"`
+	} `json:"project"`
+	ObjectAttributes struct {
+		IID          int64  `json:"iid"`
+		State        string `json:"state"`
+		Action       string `json:"action"`
+		SourceBranch string `json:"source_branch"`
+		TargetBranch string `json:"target_branch"`
+		Draft        bool   `json:"draft"`
+		WIP          bool   `json:"work_in_progress"`
+		Ref          string `json:"ref"`
+		Tag          bool   `json:"tag"`
+		Sha          string `json:"sha"`
+		BeforeSha    string `json:"before_sha"`
+		LastCommit   struct {
+			ID string `json:"id"`
+		} `json:"last_commit"`
+	} `json:"object_attributes"`
+}
+
+// Normalize returns the provider independent view of a GitLab hook
+func (p *GitlabProvider) Normalize(hook Hook) (*NormalizedEvent, error) {
+	eventType := p.GetEventType(hook)
+	var payloadData gitlabNormalizedPayload
+	if err := json.Unmarshal(hook.JSON(), &payloadData); err != nil {
+		return nil, err
+	}
+
+	event := &NormalizedEvent{
+		Provider:   GitlabName,
+		Event:      eventType,
+		DeliveryID: hook.Header(XGitlabEventUUID),
+		Kind:       OtherEventKind,
+		Repository: Repository{
+			FullName: payloadData.Project.PathWithNamespace,
+			CloneURL: payloadData.Project.GitHTTPURL,
+			SSHURL:   payloadData.Project.GitSSHURL,
+			WebURL:   payloadData.Project.WebURL,
+		},
+		Actor: p.GetActor(hook, eventType),
+	}
+	if kind, ok := gitlabEventKinds[eventType]; ok {
+		event.Kind = kind
+	}
+
+	attributes := payloadData.ObjectAttributes
+	switch eventType {
+	case GitlabPushEvent, GitlabTagPushEvent:
+		event.Ref = payloadData.Ref
+		event.Before = payloadData.Before
+		event.After = payloadData.After
+		// GitLab lists the commits of a push oldest first
+		for _, commit := range payloadData.Commits {
+			event.addCommit(commit.ID, commit.Message, commit.Added, commit.Modified, commit.Removed)
+		}
+		event.dedupeChangedFiles()
+	case GitlabMergeRequestEvent:
+		event.Ref = branchRef(attributes.SourceBranch)
+		event.After = attributes.LastCommit.ID
+		event.PullRequest = &PullRequest{
+			Number:  attributes.IID,
+			State:   attributes.State,
+			Action:  attributes.Action,
+			BaseRef: branchRef(attributes.TargetBranch),
+			HeadRef: branchRef(attributes.SourceBranch),
+			Draft:   attributes.Draft || attributes.WIP,
+		}
+	case GitlabReleaseEvent:
+		event.Ref = tagRef(payloadData.Tag)
+	case GitlabPipelineEvent:
+		event.Ref = branchRef(attributes.Ref)
+		if attributes.Tag {
+			event.Ref = tagRef(attributes.Ref)
+		}
+		event.Before = attributes.BeforeSha
+		event.After = attributes.Sha
+	}
+	return event, nil
+}
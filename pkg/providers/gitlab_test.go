@@ -246,3 +246,54 @@ func TestGitlabProvider_Validate(t *testing.T) {
 		})
 	}
 }
+
+func TestGitlabProvider_GetActor(t *testing.T) {
+	tests := []struct {
+		name    string
+		event   Event
+		payload string
+		want    Actor
+	}{
+		{
+			name:    "Push",
+			event:   GitlabPushEvent,
+			payload: `{"user_username":"project_42_bot","user_email":"project42_bot@noreply.gitlab.example.com"}`,
+			want:    Actor{Login: "project_42_bot", Email: "project42_bot@noreply.gitlab.example.com"},
+		},
+		{
+			name:    "TagPush",
+			event:   GitlabTagPushEvent,
+			payload: `{"user_username":"jane","user_email":"jane@example.com"}`,
+			want:    Actor{Login: "jane", Email: "jane@example.com"},
+		},
+		{
+			name:    "MergeRequest",
+			event:   GitlabMergeRequestEvent,
+			payload: `{"user":{"username":"jane","email":"jane@example.com"}}`,
+			want:    Actor{Login: "jane", Email: "jane@example.com"},
+		},
+		{
+			name:    "Note",
+			event:   GitlabNoteEvent,
+			payload: `{"user":{"username":"reviewer"}}`,
+			want:    Actor{Login: "reviewer"},
+		},
+		{
+			name:    "Pipeline",
+			event:   GitlabPipelineEvent,
+			payload: `{"user":{"username":"scheduler"}}`,
+			want:    Actor{Login: "scheduler"},
+		},
+	}
+	p := &GitlabProvider{}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := p.GetActor(Hook{Payload: []byte(tt.payload)}, tt.event); got != tt.want {
+				t.Errorf("GetActor() = %+v, want %+v", got, tt.want)
+			}
+			if !p.IsCommitterCheckEvent(tt.event) {
+				t.Errorf("IsCommitterCheckEvent(%q) = false, want true", tt.event)
+			}
+		})
+	}
+}
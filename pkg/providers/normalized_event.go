@@ -0,0 +1,134 @@
+package providers
+
+import "strings"
+
+// EventKind is the provider independent kind of a hook event
+type EventKind string
+
+const (
+	PushEventKind        EventKind = "push"
+	PullRequestEventKind EventKind = "pr"
+	TagEventKind         EventKind = "tag"
+	CommentEventKind     EventKind = "comment"
+	ReleaseEventKind     EventKind = "release"
+	PipelineEventKind    EventKind = "pipeline"
+	OtherEventKind       EventKind = "other"
+)
+
+const (
+	BranchRefPrefix = "refs/heads/"
+	TagRefPrefix    = "refs/tags/"
+)
+
+// NormalizedEvent is the provider independent view of a hook, so that
+// features can work the same way for GitHub and GitLab without decoding
+// Hook.Payload into provider structs themselves
+type NormalizedEvent struct {
+	Provider string `json:"provider"`
+	Event    Event  `json:"event"`
+	// DeliveryID identifies the delivery, when the provider sends one
+	DeliveryID string     `json:"deliveryID,omitempty"`
+	Kind       EventKind  `json:"kind"`
+	Repository Repository `json:"repository"`
+	// Ref is the full ref, e.g. refs/heads/main or refs/tags/v1.0. For pull
+	// and merge requests it is the head branch.
+	Ref         string       `json:"ref,omitempty"`
+	Before      string       `json:"before,omitempty"`
+	After       string       `json:"after,omitempty"`
+	Actor       Actor        `json:"actor"`
+	PullRequest *PullRequest `json:"pullRequest,omitempty"`
+	// Commits of a push, oldest first so that the head commit is last
+	Commits []Commit `json:"commits,omitempty"`
+	// ChangedFiles are the paths added, modified or removed by the commits
+	ChangedFiles []string `json:"changedFiles,omitempty"`
+}
+
+// Repository identifies the repository a hook was sent for
+type Repository struct {
+	FullName string `json:"fullName"`
+	CloneURL string `json:"cloneURL,omitempty"`
+	SSHURL   string `json:"sshURL,omitempty"`
+	WebURL   string `json:"webURL,omitempty"`
+}
+
+// PullRequest describes a GitHub pull request or GitLab merge request
+type PullRequest struct {
+	Number  int64  `json:"number"`
+	State   string `json:"state"`
+	Action  string `json:"action"`
+	BaseRef string `json:"baseRef"`
+	HeadRef string `json:"headRef"`
+	Draft   bool   `json:"draft"`
+}
+
+// Commit is a commit of a push
+type Commit struct {
+	ID      string `json:"id"`
+	Message string `json:"message"`
+}
+
+// HeadCommit returns the last commit of a push, if any
+func (e *NormalizedEvent) HeadCommit() *Commit {
+	if len(e.Commits) == 0 {
+		return nil
+	}
+	return &e.Commits[len(e.Commits)-1]
+}
+
+// Refs returns the refs of the event: the base and head branches of a pull
+// request, or the single ref of other events
+func (e *NormalizedEvent) Refs() []string {
+	if e.PullRequest != nil {
+		return []string{e.PullRequest.BaseRef, e.PullRequest.HeadRef}
+	}
+	if len(e.Ref) > 0 {
+		return []string{e.Ref}
+	}
+	return nil
+}
+
+// addCommit appends a commit of a push and the files it touched. Call
+// dedupeChangedFiles once all commits are added.
+func (e *NormalizedEvent) addCommit(id string, message string, files ...[]string) {
+	e.Commits = append(e.Commits, Commit{ID: id, Message: message})
+	for _, list := range files {
+		e.ChangedFiles = append(e.ChangedFiles, list...)
+	}
+}
+
+// dedupeChangedFiles keeps the first occurrence of every changed file
+func (e *NormalizedEvent) dedupeChangedFiles() {
+	seen := make(map[string]bool, len(e.ChangedFiles))
+	files := e.ChangedFiles[:0]
+	for _, file := range e.ChangedFiles {
+		if !seen[file] {
+			seen[file] = true
+			files = append(files, file)
+		}
+	}
+	e.ChangedFiles = files
+}
+
+// branchRef returns the full ref of a branch name, keeping full refs as they are
+func branchRef(branch string) string {
+	if len(branch) == 0 || strings.HasPrefix(branch, "refs/") {
+		return branch
+	}
+	return BranchRefPrefix + branch
+}
+
+// tagRef returns the full ref of a tag name, keeping full refs as they are
+func tagRef(tag string) string {
+	if len(tag) == 0 || strings.HasPrefix(tag, "refs/") {
+		return tag
+	}
+	return TagRefPrefix + tag
+}
+
+// pushKind tells branch pushes from tag pushes by their ref
+func pushKind(ref string) EventKind {
+	if strings.HasPrefix(ref, TagRefPrefix) {
+		return TagEventKind
+	}
+	return PushEventKind
+}
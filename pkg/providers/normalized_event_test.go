@@ -0,0 +1,232 @@
+package providers
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestProvider_Normalize(t *testing.T) {
+	github := &GithubProvider{}
+	gitlab := &GitlabProvider{}
+
+	tests := []struct {
+		name     string
+		provider Provider
+		event    Event
+		payload  string
+		want     *NormalizedEvent
+	}{
+		{
+			name:     "GithubPush",
+			provider: github,
+			event:    GithubPushEvent,
+			payload: `{"ref":"refs/heads/main","before":"a","after":"c",
+				"repository":{"full_name":"stakater/app","clone_url":"https://github.com/stakater/app.git","ssh_url":"git@github.com:stakater/app.git","html_url":"https://github.com/stakater/app"},
+				"commits":[
+					{"id":"b","message":"first","added":["x.go"],"modified":["go.mod"]},
+					{"id":"c","message":"second","modified":["go.mod"],"removed":["y.go"]}],
+				"head_commit":{"id":"c","message":"second"},
+				"pusher":{"email":"jane@example.com"},"sender":{"login":"jane","type":"User"}}`,
+			want: &NormalizedEvent{
+				Provider: GithubName,
+				Event:    GithubPushEvent,
+				Kind:     PushEventKind,
+				Repository: Repository{
+					FullName: "stakater/app",
+					CloneURL: "https://github.com/stakater/app.git",
+					SSHURL:   "git@github.com:stakater/app.git",
+					WebURL:   "https://github.com/stakater/app",
+				},
+				Ref:          "refs/heads/main",
+				Before:       "a",
+				After:        "c",
+				Actor:        Actor{Login: "jane", Type: "User", Email: "jane@example.com"},
+				Commits:      []Commit{{ID: "b", Message: "first"}, {ID: "c", Message: "second"}},
+				ChangedFiles: []string{"x.go", "go.mod", "y.go"},
+			},
+		},
+		{
+			name:     "GithubTagPush",
+			provider: github,
+			event:    GithubPushEvent,
+			payload:  `{"ref":"refs/tags/v1.0","head_commit":{"id":"c","message":"release"}}`,
+			want: &NormalizedEvent{
+				Provider: GithubName,
+				Event:    GithubPushEvent,
+				Kind:     TagEventKind,
+				Ref:      "refs/tags/v1.0",
+				Commits:  []Commit{{ID: "c", Message: "release"}},
+			},
+		},
+		{
+			name:     "GithubPullRequest",
+			provider: github,
+			event:    GithubPullRequestEvent,
+			payload: `{"action":"opened","pull_request":{"number":7,"state":"open","draft":true,
+				"base":{"ref":"main"},"head":{"ref":"feature/x","sha":"d"}},"sender":{"login":"jane"}}`,
+			want: &NormalizedEvent{
+				Provider: GithubName,
+				Event:    GithubPullRequestEvent,
+				Kind:     PullRequestEventKind,
+				Ref:      "refs/heads/feature/x",
+				After:    "d",
+				Actor:    Actor{Login: "jane"},
+				PullRequest: &PullRequest{
+					Number:  7,
+					State:   "open",
+					Action:  "opened",
+					BaseRef: "refs/heads/main",
+					HeadRef: "refs/heads/feature/x",
+					Draft:   true,
+				},
+			},
+		},
+		{
+			name:     "GithubRelease",
+			provider: github,
+			event:    GithubReleaseEvent,
+			payload:  `{"release":{"tag_name":"v2.0"}}`,
+			want: &NormalizedEvent{
+				Provider: GithubName,
+				Event:    GithubReleaseEvent,
+				Kind:     ReleaseEventKind,
+				Ref:      "refs/tags/v2.0",
+			},
+		},
+		{
+			name:     "GithubCreateTag",
+			provider: github,
+			event:    GithubCreateEvent,
+			payload:  `{"ref":"v2.0","ref_type":"tag"}`,
+			want: &NormalizedEvent{
+				Provider: GithubName,
+				Event:    GithubCreateEvent,
+				Kind:     TagEventKind,
+				Ref:      "refs/tags/v2.0",
+			},
+		},
+		{
+			name:     "GithubIssueComment",
+			provider: github,
+			event:    GithubIssueCommentEvent,
+			payload:  `{"comment":{"user":{"login":"reviewer"}}}`,
+			want: &NormalizedEvent{
+				Provider: GithubName,
+				Event:    GithubIssueCommentEvent,
+				Kind:     CommentEventKind,
+				Actor:    Actor{Login: "reviewer"},
+			},
+		},
+		{
+			name:     "GitlabPush",
+			provider: gitlab,
+			event:    GitlabPushEvent,
+			payload: `{"ref":"refs/heads/main","before":"a","after":"b","user_username":"jane",
+				"project":{"path_with_namespace":"group/app","git_http_url":"https://gitlab.com/group/app.git","git_ssh_url":"git@gitlab.com:group/app.git","web_url":"https://gitlab.com/group/app"},
+				"commits":[{"id":"b","message":"fix","added":["a.go"],"modified":["a.go"]}]}`,
+			want: &NormalizedEvent{
+				Provider: GitlabName,
+				Event:    GitlabPushEvent,
+				Kind:     PushEventKind,
+				Repository: Repository{
+					FullName: "group/app",
+					CloneURL: "https://gitlab.com/group/app.git",
+					SSHURL:   "git@gitlab.com:group/app.git",
+					WebURL:   "https://gitlab.com/group/app",
+				},
+				Ref:          "refs/heads/main",
+				Before:       "a",
+				After:        "b",
+				Actor:        Actor{Login: "jane"},
+				Commits:      []Commit{{ID: "b", Message: "fix"}},
+				ChangedFiles: []string{"a.go"},
+			},
+		},
+		{
+			name:     "GitlabMergeRequest",
+			provider: gitlab,
+			event:    GitlabMergeRequestEvent,
+			payload: `{"user":{"username":"jane"},"object_attributes":{"iid":3,"state":"opened","action":"update",
+				"source_branch":"feature/x","target_branch":"main","work_in_progress":true,"last_commit":{"id":"e"}}}`,
+			want: &NormalizedEvent{
+				Provider: GitlabName,
+				Event:    GitlabMergeRequestEvent,
+				Kind:     PullRequestEventKind,
+				Ref:      "refs/heads/feature/x",
+				After:    "e",
+				Actor:    Actor{Login: "jane"},
+				PullRequest: &PullRequest{
+					Number:  3,
+					State:   "opened",
+					Action:  "update",
+					BaseRef: "refs/heads/main",
+					HeadRef: "refs/heads/feature/x",
+					Draft:   true,
+				},
+			},
+		},
+		{
+			name:     "GitlabTagPipeline",
+			provider: gitlab,
+			event:    GitlabPipelineEvent,
+			payload:  `{"object_attributes":{"ref":"v1.0","tag":true,"sha":"f","before_sha":"e"}}`,
+			want: &NormalizedEvent{
+				Provider: GitlabName,
+				Event:    GitlabPipelineEvent,
+				Kind:     PipelineEventKind,
+				Ref:      "refs/tags/v1.0",
+				Before:   "e",
+				After:    "f",
+			},
+		},
+		{
+			name:     "GitlabUnknownEvent",
+			provider: gitlab,
+			event:    "Wiki Page Hook",
+			payload:  `{"user":{"username":"jane"}}`,
+			want: &NormalizedEvent{
+				Provider: GitlabName,
+				Event:    "Wiki Page Hook",
+				Kind:     OtherEventKind,
+				Actor:    Actor{Login: "jane"},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			hook := Hook{
+				Payload: []byte(tt.payload),
+				Headers: map[string]string{XGitHubEvent: string(tt.event), XGitlabEvent: string(tt.event)},
+			}
+			got, err := tt.provider.Normalize(hook)
+			if err != nil {
+				t.Fatalf("Normalize() error = %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Normalize() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestProvider_NormalizeInvalidPayload(t *testing.T) {
+	for _, provider := range []Provider{&GithubProvider{}, &GitlabProvider{}} {
+		if _, err := provider.Normalize(Hook{Payload: []byte("{"), Headers: map[string]string{}}); err == nil {
+			t.Errorf("%s Normalize() error = nil, want an error", provider.GetProviderName())
+		}
+	}
+}
+
+func TestNormalizedEvent_Refs(t *testing.T) {
+	push := &NormalizedEvent{Ref: "refs/heads/main"}
+	if got := push.Refs(); !reflect.DeepEqual(got, []string{"refs/heads/main"}) {
+		t.Errorf("Refs() of push = %v", got)
+	}
+	pr := &NormalizedEvent{Ref: "refs/heads/x", PullRequest: &PullRequest{BaseRef: "refs/heads/main", HeadRef: "refs/heads/x"}}
+	if got := pr.Refs(); !reflect.DeepEqual(got, []string{"refs/heads/main", "refs/heads/x"}) {
+		t.Errorf("Refs() of pull request = %v", got)
+	}
+	if got := (&NormalizedEvent{}).Refs(); got != nil {
+		t.Errorf("Refs() without ref = %v, want nil", got)
+	}
+}
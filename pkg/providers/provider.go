@@ -10,6 +10,10 @@ const (
 	GitlabProviderKind            = "gitlab"
 	ContentTypeHeader             = "Content-Type"
 	DefaultContentTypeHeaderValue = "application/json"
+	// FormContentTypeHeaderValue is the content type of GitHub hooks that send
+	// the JSON payload in the FormPayloadField of a form
+	FormContentTypeHeaderValue = "application/x-www-form-urlencoded"
+	FormPayloadField           = "payload"
 )
 
 // Event defines a provider hook event type
@@ -21,6 +25,9 @@ type Provider interface {
 	GetEventType(hook Hook) Event
 	IsCommitterCheckEvent(event Event) bool
 	GetCommitter(hook Hook, eventType Event) string
+	GetActor(hook Hook, eventType Event) Actor
+	// Normalize returns the provider independent view of the hook
+	Normalize(hook Hook) (*NormalizedEvent, error)
 	GetProviderName() string
 }
 
@@ -45,7 +52,33 @@ func NewProvider(provider string, secret string) (Provider, error) {
 }
 
 type Hook struct {
-	Payload       []byte
+	// Payload is the body as received, which signatures are computed over
+	Payload []byte
+	// Data is the JSON payload decoded from the body of form encoded hooks,
+	// nil when Payload is the JSON payload itself
+	Data          []byte
 	Headers       map[string]string
 	RequestMethod string
 }
+
+// JSON returns the JSON payload of the hook, whatever its content type
+func (h Hook) JSON() []byte {
+	if h.Data != nil {
+		return h.Data
+	}
+	return h.Payload
+}
+
+// Header returns the value of the named header, matching its name
+// case-insensitively since Headers keep the casing they were received in
+func (h Hook) Header(name string) string {
+	if value, ok := h.Headers[name]; ok {
+		return value
+	}
+	for key, value := range h.Headers {
+		if strings.EqualFold(key, name) {
+			return value
+		}
+	}
+	return ""
+}
@@ -0,0 +1,333 @@
+package proxy
+
+import (
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/stakater/GitWebhookProxy/pkg/config"
+	"gopkg.in/yaml.v2"
+)
+
+// Redacted replaces secrets in the configuration and deliveries shown by
+// the admin API
+const Redacted = "REDACTED"
+
+// sensitiveNames are the parts of header and query parameter names whose
+// values are redacted
+var sensitiveNames = []string{
+	"token", "secret", "password", "passwd", "credential", "signature",
+	"authorization", "cookie", "apikey", "api_key", "api-key",
+}
+
+// AdminOptions configures the admin listener
+type AdminOptions struct {
+	Address string
+	// Token must be sent as "Authorization: Bearer <token>" with every request
+	Token string
+	// Reload reloads the configuration, POST /reload is not available when nil
+	Reload func() error
+	// TLS terminates TLS with the same options as the proxy listener. The
+	// admin listener serves plain HTTP when nil.
+	TLS *TLSOptions
+}
+
+// effectiveConfig is the YAML view of the settings the proxy runs with
+type effectiveConfig struct {
+	Provider        string         `yaml:"provider"`
+	UpstreamURLs    []string       `yaml:"upstreamURLs"`
+	AllowedPaths    []string       `yaml:"allowedPaths"`
+	Secret          string         `yaml:"secret"`
+	IgnoredUsers    []string       `yaml:"ignoredUsers"`
+	AllowedUsers    []string       `yaml:"allowedUsers"`
+	IgnoreBots      bool           `yaml:"ignoreBots"`
+	BotEmailDomains []string       `yaml:"botEmailDomains"`
+	MaxBodySize     int64          `yaml:"maxBodySize"`
+	Config          *config.Config `yaml:"config,omitempty"`
+}
+
+// adminStats reports the work queued in the proxy
+type adminStats struct {
+	// InFlight counts hooks being delivered, including coalesced pushes
+	// waiting for their window to close
+	InFlight int `json:"inFlight"`
+	// PendingPushes counts coalesced pushes waiting for their window to close
+	PendingPushes int `json:"pendingPushes"`
+	// CoalescedPushes counts the pushes replaced by the pending ones
+	CoalescedPushes  int  `json:"coalescedPushes"`
+	RateLimitBuckets int  `json:"rateLimitBuckets"`
+	Draining         bool `json:"draining"`
+}
+
+// RunAdmin starts the admin listener. It serves the effective configuration
+// with secrets redacted, the state of the upstreams, queue statistics and the
+// recent deliveries, and lets upstreams be paused and resumed and the
+// configuration be reloaded.
+func (p *Proxy) RunAdmin(opts AdminOptions) error {
+	if len(strings.TrimSpace(opts.Address)) == 0 {
+		return errors.New("Cannot start admin listener with empty address")
+	}
+	if len(opts.Token) == 0 {
+		return errors.New("Cannot start admin listener without a token")
+	}
+
+	server := &http.Server{
+		Addr:    opts.Address,
+		Handler: p.newAdminRouter(opts),
+	}
+	if opts.TLS != nil {
+		return p.serveTLS(server, *opts.TLS, "Admin listening")
+	}
+	if !p.trackServer(server) {
+		return nil
+	}
+
+	log.Printf("Admin listening at: %s", opts.Address)
+	return ignoreServerClosed(server.ListenAndServe())
+}
+
+func (p *Proxy) newAdminRouter(opts AdminOptions) http.Handler {
+	router := httprouter.New()
+	router.GET("/config", p.adminConfig)
+	router.GET("/upstreams", p.adminUpstreams)
+	router.POST("/upstreams/pause", p.adminPause(true))
+	router.POST("/upstreams/resume", p.adminPause(false))
+	router.GET("/stats", p.adminStats)
+	router.POST("/reload", adminReload(opts.Reload))
+	router.GET("/", p.adminDeliveriesPage)
+	router.GET("/deliveries", p.adminDeliveries)
+	router.GET("/deliveries/:id", p.adminDelivery)
+	return requireToken(opts.Token, router)
+}
+
+// requireToken rejects requests without the token, sent either as a bearer
+// token or as the password of basic authentication so that browsers can show
+// the deliveries page. Browsers resend basic credentials with requests that
+// any site makes, so they are only accepted for GET and HEAD; requests that
+// change state need the bearer token, which a browser never adds by itself.
+func requireToken(token string, next http.Handler) http.Handler {
+	expected := []byte(token)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		readOnly := r.Method == http.MethodGet || r.Method == http.MethodHead
+		var sent string
+		if authorization := r.Header.Get("Authorization"); strings.HasPrefix(authorization, "Bearer ") {
+			sent = strings.TrimPrefix(authorization, "Bearer ")
+		} else if _, password, ok := r.BasicAuth(); ok && readOnly {
+			sent = password
+		}
+		if len(sent) == 0 || subtle.ConstantTimeCompare([]byte(sent), expected) != 1 {
+			w.Header().Add("WWW-Authenticate", "Bearer")
+			if readOnly {
+				w.Header().Add("WWW-Authenticate", `Basic realm="GitWebhookProxy admin"`)
+			}
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (p *Proxy) adminConfig(w http.ResponseWriter, r *http.Request, params httprouter.Params) {
+	data, err := yaml.Marshal(p.effectiveConfig())
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Error encoding configuration: %s", err), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/yaml")
+	w.WriteHeader(http.StatusOK)
+	w.Write(data)
+}
+
+func (p *Proxy) adminUpstreams(w http.ResponseWriter, r *http.Request, params httprouter.Params) {
+	statuses := []UpstreamStatus{}
+	for _, u := range p.upstreamStates() {
+		statuses = append(statuses, redactedStatus(u))
+	}
+	writeJSON(w, http.StatusOK, statuses)
+}
+
+// adminPause pauses or resumes the upstream given by the url query
+// parameter, either as configured or as listed by GET /upstreams
+func (p *Proxy) adminPause(paused bool) httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, params httprouter.Params) {
+		upstreamURL := r.URL.Query().Get("url")
+		if len(upstreamURL) == 0 {
+			http.Error(w, "Query parameter 'url' is required", http.StatusBadRequest)
+			return
+		}
+
+		var found *upstream
+		for _, u := range p.upstreamStates() {
+			if u.url == upstreamURL || redactURL(u.url) == upstreamURL {
+				found = u
+				break
+			}
+		}
+		if found == nil {
+			http.Error(w, fmt.Sprintf("Upstream '%s' not found", upstreamURL), http.StatusNotFound)
+			return
+		}
+
+		found.setPaused(paused)
+		action := "Resumed"
+		if paused {
+			action = "Paused"
+		}
+		log.Printf("%s upstream '%s' through the admin API", action, redactURL(found.url))
+
+		writeJSON(w, http.StatusOK, redactedStatus(found))
+	}
+}
+
+func (p *Proxy) adminStats(w http.ResponseWriter, r *http.Request, params httprouter.Params) {
+	stats := adminStats{
+		InFlight:         p.inFlightDeliveries(),
+		RateLimitBuckets: p.limiterSize(),
+		Draining:         p.isDraining(),
+	}
+	p.pushesMu.Lock()
+	for _, push := range p.pendingPushes {
+		stats.PendingPushes++
+		stats.CoalescedPushes += push.coalesced
+	}
+	p.pushesMu.Unlock()
+	writeJSON(w, http.StatusOK, stats)
+}
+
+func adminReload(reload func() error) httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, params httprouter.Params) {
+		if reload == nil {
+			http.Error(w, "Reloading is not available", http.StatusNotImplemented)
+			return
+		}
+		if err := reload(); err != nil {
+			log.Printf("Error reloading configuration through the admin API: %s", err)
+			http.Error(w, fmt.Sprintf("Error reloading configuration: %s", err), http.StatusInternalServerError)
+			return
+		}
+		log.Printf("Reloaded configuration through the admin API")
+		writeJSON(w, http.StatusOK, map[string]string{"status": "reloaded"})
+	}
+}
+
+func redactedStatus(u *upstream) UpstreamStatus {
+	status := u.status()
+	status.URL = redactURL(status.URL)
+	status.HealthURL = redactURL(status.HealthURL)
+	return status
+}
+
+// limiterSize returns the number of rate limit buckets kept
+func (p *Proxy) limiterSize() int {
+	p.upstreamsMu.Lock()
+	limiter := p.limiter
+	p.upstreamsMu.Unlock()
+	return limiter.size()
+}
+
+// effectiveConfig returns the settings of the proxy with secrets redacted
+func (p *Proxy) effectiveConfig() effectiveConfig {
+	effective := effectiveConfig{
+		Provider:        p.provider,
+		AllowedPaths:    p.allowedPaths,
+		IgnoredUsers:    p.ignoredUsers,
+		AllowedUsers:    p.allowedUsers,
+		IgnoreBots:      p.botOptions.Ignore,
+		BotEmailDomains: p.botOptions.EmailDomains,
+		MaxBodySize:     p.maxBodySize,
+	}
+	if len(p.secret) > 0 {
+		effective.Secret = Redacted
+	}
+
+	p.upstreamsMu.Lock()
+	defer p.upstreamsMu.Unlock()
+	for _, upstreamURL := range p.upstreamURLs {
+		effective.UpstreamURLs = append(effective.UpstreamURLs, redactURL(upstreamURL))
+	}
+	if p.config != nil {
+		effective.Config = redactConfig(p.config)
+	}
+	return effective
+}
+
+// redactConfig returns a copy of cfg with credentials in upstream URLs and
+// the values of sensitive headers redacted
+func redactConfig(cfg *config.Config) *config.Config {
+	copied := *cfg
+	copied.Upstreams = make([]config.Upstream, len(cfg.Upstreams))
+	for i, upstream := range cfg.Upstreams {
+		upstream.URL = redactURL(upstream.URL)
+		upstream.HealthURL = redactURL(upstream.HealthURL)
+
+		if len(upstream.Headers.Set) > 0 {
+			set := make(map[string]string, len(upstream.Headers.Set))
+			for name, value := range upstream.Headers.Set {
+				if isSensitiveName(name) {
+					value = Redacted
+				}
+				set[name] = value
+			}
+			upstream.Headers.Set = set
+		}
+
+		if len(upstream.Transform.Headers) > 0 {
+			headers := make(map[string]config.Template, len(upstream.Transform.Headers))
+			for name, value := range upstream.Transform.Headers {
+				if isSensitiveName(name) {
+					value, _ = config.ParseTemplate(Redacted)
+				}
+				headers[name] = value
+			}
+			upstream.Transform.Headers = headers
+		}
+		copied.Upstreams[i] = upstream
+	}
+	return &copied
+}
+
+// redactURL hides the password of the user info and the values of sensitive
+// query parameters
+func redactURL(rawURL string) string {
+	parsed, err := url.Parse(rawURL)
+	if err != nil {
+		return rawURL
+	}
+	changed := false
+	if parsed.User != nil {
+		if _, ok := parsed.User.Password(); ok {
+			parsed.User = url.UserPassword(parsed.User.Username(), Redacted)
+			changed = true
+		}
+	}
+	query := parsed.Query()
+	for name := range query {
+		if isSensitiveName(name) {
+			query.Set(name, Redacted)
+			changed = true
+		}
+	}
+	if !changed {
+		return rawURL
+	}
+	parsed.RawQuery = query.Encode()
+	return parsed.String()
+}
+
+func isSensitiveName(name string) bool {
+	name = strings.ToLower(name)
+	if name == "key" {
+		return true
+	}
+	for _, sensitive := range sensitiveNames {
+		if strings.Contains(name, sensitive) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,47 @@
+package proxy
+
+import (
+	"strings"
+
+	"github.com/stakater/GitWebhookProxy/pkg/providers"
+)
+
+// BotOptions configures how hooks sent by automation accounts are handled
+type BotOptions struct {
+	// Ignore drops hooks from bots instead of forwarding them
+	Ignore bool
+	// EmailDomains marks actors with an email in one of these domains as
+	// bots, e.g. the domain of service accounts
+	EmailDomains []string
+}
+
+// ConfigureBots sets how hooks sent by bots are handled
+func (p *Proxy) ConfigureBots(opts BotOptions) {
+	domains := []string{}
+	for _, domain := range opts.EmailDomains {
+		domain = strings.ToLower(strings.TrimPrefix(strings.TrimSpace(domain), "@"))
+		if len(domain) > 0 {
+			domains = append(domains, domain)
+		}
+	}
+	opts.EmailDomains = domains
+	p.botOptions = opts
+}
+
+// isIgnoredBot reports whether the hook must be dropped because its actor
+// is a bot
+func (p *Proxy) isIgnoredBot(actor providers.Actor) bool {
+	if !p.botOptions.Ignore {
+		return false
+	}
+	if actor.IsBot() {
+		return true
+	}
+	domain := actor.EmailDomain()
+	for _, botDomain := range p.botOptions.EmailDomains {
+		if domain == botDomain {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,65 @@
+package proxy
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stakater/GitWebhookProxy/pkg/providers"
+)
+
+func TestProxy_isIgnoredBot(t *testing.T) {
+	p := &Proxy{}
+	p.ConfigureBots(BotOptions{Ignore: true, EmailDomains: []string{" @CI.example.com", ""}})
+
+	tests := []struct {
+		name  string
+		actor providers.Actor
+		want  bool
+	}{
+		{"User", providers.Actor{Login: "octocat", Type: "User", Email: "octocat@example.com"}, false},
+		{"GithubApp", providers.Actor{Login: "dependabot[bot]"}, true},
+		{"ServiceAccountEmail", providers.Actor{Login: "jenkins", Email: "jenkins@ci.example.com"}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := p.isIgnoredBot(tt.actor); got != tt.want {
+				t.Errorf("isIgnoredBot() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	p.ConfigureBots(BotOptions{EmailDomains: []string{"ci.example.com"}})
+	if p.isIgnoredBot(providers.Actor{Login: "dependabot[bot]"}) {
+		t.Errorf("isIgnoredBot() = true with Ignore disabled, want false")
+	}
+}
+
+func TestProxy_proxyRequestIgnoresBots(t *testing.T) {
+	hits := 0
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits++
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer upstream.Close()
+
+	p, err := NewProxy([]string{upstream.URL}, []string{}, providers.GitlabProviderKind, "", []string{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	p.ConfigureBots(BotOptions{Ignore: true})
+	router := p.newRouter()
+
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, createGitlabRequest(http.MethodPost, "/post", "", proxyGitlabTestEvent, `{"user_username":"project_42_bot"}`))
+	if rr.Code != http.StatusOK || !strings.Contains(rr.Body.String(), "Ignoring request for bot: project_42_bot") {
+		t.Errorf("got %v %q, want 200 ignoring the bot", rr.Code, rr.Body.String())
+	}
+
+	rr = httptest.NewRecorder()
+	router.ServeHTTP(rr, createGitlabRequest(http.MethodPost, "/post", "", proxyGitlabTestEvent, `{"user_username":"jane"}`))
+	if rr.Code != http.StatusOK || hits != 1 {
+		t.Errorf("got %v with %d upstream hits, want the human's push forwarded once", rr.Code, hits)
+	}
+}
@@ -0,0 +1,172 @@
+package proxy
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+const (
+	circuitClosed   = "closed"
+	circuitOpen     = "open"
+	circuitHalfOpen = "half-open"
+
+	defaultCircuitBreakerWindow   = 20
+	defaultCircuitBreakerCooldown = time.Second * 30
+)
+
+var errCircuitOpen = errors.New("circuit breaker is open")
+
+// CircuitBreakerOptions configures the circuit kept for every upstream. The
+// circuit opens after ConsecutiveFailures failures in a row, or once the
+// failure ratio over the last Window deliveries reaches ErrorRate. A zero
+// value disables the respective trigger.
+type CircuitBreakerOptions struct {
+	ConsecutiveFailures int
+	ErrorRate           float64
+	Window              int
+	Cooldown            time.Duration
+}
+
+func (o CircuitBreakerOptions) enabled() bool {
+	return o.ConsecutiveFailures > 0 || o.ErrorRate > 0
+}
+
+// circuitBreaker is a closed/open/half-open breaker. While open every delivery
+// is skipped; after the cooldown a single trial delivery is let through and
+// its outcome closes or re-opens the circuit.
+type circuitBreaker struct {
+	opts CircuitBreakerOptions
+	now  func() time.Time
+
+	mu                  sync.Mutex
+	state               string
+	openedAt            time.Time
+	trialInFlight       bool
+	consecutiveFailures int
+	outcomes            []bool
+	next                int
+}
+
+func newCircuitBreaker(opts CircuitBreakerOptions) *circuitBreaker {
+	if opts.Window <= 0 {
+		opts.Window = defaultCircuitBreakerWindow
+	}
+	if opts.Cooldown <= 0 {
+		opts.Cooldown = defaultCircuitBreakerCooldown
+	}
+	return &circuitBreaker{
+		opts:  opts,
+		now:   time.Now,
+		state: circuitClosed,
+	}
+}
+
+// allow reports whether a delivery may be attempted right now
+func (b *circuitBreaker) allow() bool {
+	if b == nil {
+		return true
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch b.state {
+	case circuitOpen:
+		if b.now().Sub(b.openedAt) < b.opts.Cooldown {
+			return false
+		}
+		b.state = circuitHalfOpen
+		b.trialInFlight = true
+		return true
+	case circuitHalfOpen:
+		if b.trialInFlight {
+			return false
+		}
+		b.trialInFlight = true
+		return true
+	}
+	return true
+}
+
+// record stores the outcome of a delivery that allow let through
+func (b *circuitBreaker) record(success bool) {
+	if b == nil {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.state == circuitHalfOpen {
+		b.trialInFlight = false
+		if success {
+			b.reset()
+		} else {
+			b.open()
+		}
+		return
+	}
+
+	if success {
+		b.consecutiveFailures = 0
+	} else {
+		b.consecutiveFailures++
+	}
+	if len(b.outcomes) < b.opts.Window {
+		b.outcomes = append(b.outcomes, success)
+	} else {
+		b.outcomes[b.next] = success
+		b.next = (b.next + 1) % b.opts.Window
+	}
+
+	if b.opts.ConsecutiveFailures > 0 && b.consecutiveFailures >= b.opts.ConsecutiveFailures {
+		b.open()
+		return
+	}
+	if b.opts.ErrorRate > 0 && len(b.outcomes) == b.opts.Window && b.errorRate() >= b.opts.ErrorRate {
+		b.open()
+	}
+}
+
+func (b *circuitBreaker) errorRate() float64 {
+	failures := 0
+	for _, success := range b.outcomes {
+		if !success {
+			failures++
+		}
+	}
+	return float64(failures) / float64(len(b.outcomes))
+}
+
+func (b *circuitBreaker) open() {
+	b.state = circuitOpen
+	b.openedAt = b.now()
+}
+
+func (b *circuitBreaker) reset() {
+	b.state = circuitClosed
+	b.consecutiveFailures = 0
+	b.outcomes = nil
+	b.next = 0
+}
+
+func (b *circuitBreaker) currentState() string {
+	if b == nil {
+		return ""
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.state == circuitOpen && b.now().Sub(b.openedAt) >= b.opts.Cooldown {
+		return circuitHalfOpen
+	}
+	return b.state
+}
+
+// ConfigureCircuitBreakers enables a circuit breaker for every upstream
+func (p *Proxy) ConfigureCircuitBreakers(opts CircuitBreakerOptions) {
+	p.upstreamsMu.Lock()
+	defer p.upstreamsMu.Unlock()
+	p.breakerOptions = opts
+	for _, u := range p.upstreams {
+		u.setBreaker(opts)
+	}
+}
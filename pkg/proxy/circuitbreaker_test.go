@@ -0,0 +1,111 @@
+package proxy
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stakater/GitWebhookProxy/pkg/providers"
+)
+
+func TestCircuitBreaker_ConsecutiveFailures(t *testing.T) {
+	now := time.Now()
+	b := newCircuitBreaker(CircuitBreakerOptions{ConsecutiveFailures: 2, Cooldown: time.Minute})
+	b.now = func() time.Time { return now }
+
+	b.record(false)
+	if !b.allow() {
+		t.Fatalf("circuit opened after a single failure")
+	}
+	b.record(false)
+	if b.allow() {
+		t.Fatalf("circuit still closed after two consecutive failures")
+	}
+	if got := b.currentState(); got != circuitOpen {
+		t.Errorf("currentState() = %v, want %v", got, circuitOpen)
+	}
+
+	now = now.Add(time.Minute)
+	if !b.allow() {
+		t.Fatalf("circuit did not half-open after the cooldown")
+	}
+	if b.allow() {
+		t.Errorf("half-open circuit let a second trial delivery through")
+	}
+	b.record(false)
+	if b.allow() {
+		t.Fatalf("failed trial delivery did not re-open the circuit")
+	}
+
+	now = now.Add(time.Minute)
+	if !b.allow() {
+		t.Fatalf("circuit did not half-open after the second cooldown")
+	}
+	b.record(true)
+	if got := b.currentState(); got != circuitClosed {
+		t.Errorf("currentState() after successful trial = %v, want %v", got, circuitClosed)
+	}
+}
+
+func TestCircuitBreaker_ErrorRate(t *testing.T) {
+	b := newCircuitBreaker(CircuitBreakerOptions{ErrorRate: 0.5, Window: 4})
+
+	for _, success := range []bool{true, false, true} {
+		b.record(success)
+	}
+	if !b.allow() {
+		t.Fatalf("circuit opened before the window was full")
+	}
+	b.record(false)
+	if b.allow() {
+		t.Errorf("circuit still closed at an error rate of 0.5")
+	}
+}
+
+func TestCircuitBreaker_Disabled(t *testing.T) {
+	var b *circuitBreaker
+	b.record(false)
+	if !b.allow() {
+		t.Errorf("nil circuit breaker should always allow deliveries")
+	}
+}
+
+func TestProxy_proxyRequestSkipsOpenCircuit(t *testing.T) {
+	downHits := 0
+	down := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		downHits++
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer down.Close()
+	up := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer up.Close()
+
+	p, err := NewProxy([]string{down.URL, up.URL}, []string{}, providers.GitlabProviderKind, "", []string{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	p.ConfigureCircuitBreakers(CircuitBreakerOptions{ConsecutiveFailures: 2, Cooldown: time.Hour})
+	router := p.newRouter()
+
+	for i := 0; i < 4; i++ {
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, createGitlabRequest(http.MethodPost, "/post", "", proxyGitlabTestEvent, "{}"))
+		if rr.Code != http.StatusOK {
+			t.Errorf("request %d got status %v, want %v", i, rr.Code, http.StatusOK)
+		}
+	}
+	if downHits != 2 {
+		t.Errorf("failing upstream was hit %d times, want 2 before its circuit opened", downHits)
+	}
+
+	statuses := p.upstreamStates()
+	if got := statuses[0].status().Circuit; got != circuitOpen {
+		t.Errorf("failing upstream circuit = %v, want %v", got, circuitOpen)
+	}
+	if got := statuses[1].status().Circuit; got != circuitClosed {
+		t.Errorf("healthy upstream circuit = %v, want %v", got, circuitClosed)
+	}
+}
@@ -0,0 +1,97 @@
+package proxy
+
+import (
+	"crypto/tls"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/stakater/GitWebhookProxy/pkg/config"
+)
+
+const (
+	defaultConnectTimeout      = time.Second * 30
+	defaultKeepAlive           = time.Second * 30
+	defaultTLSHandshakeTimeout = time.Second * 10
+	defaultIdleConnTimeout     = time.Second * 90
+	defaultMaxIdleConns        = 100
+	defaultOverallTimeout      = time.Second * 30
+)
+
+func durationOr(value config.Duration, fallback time.Duration) time.Duration {
+	if value > 0 {
+		return time.Duration(value)
+	}
+	return fallback
+}
+
+// hasClientSettings reports whether the upstream needs its own http.Client
+// rather than the shared one
+func hasClientSettings(cfg config.Upstream) bool {
+	return cfg.Timeouts != (config.Timeouts{}) ||
+		cfg.Connections.MaxIdle > 0 || cfg.Connections.MaxIdlePerHost > 0 ||
+		cfg.Connections.IdleTimeout > 0 || cfg.Connections.KeepAlive > 0 ||
+		cfg.Connections.DisableKeepAlives || cfg.Connections.HTTP2 != nil
+}
+
+// newUpstreamClient builds a dedicated http.Client for an upstream. Settings
+// left empty fall back to the values of the shared httpClient.
+func newUpstreamClient(cfg config.Upstream) *http.Client {
+	dialer := &net.Dialer{
+		Timeout:   durationOr(cfg.Timeouts.Connect, defaultConnectTimeout),
+		KeepAlive: durationOr(cfg.Connections.KeepAlive, defaultKeepAlive),
+	}
+
+	upstreamTransport := &http.Transport{
+		Proxy:                 http.ProxyFromEnvironment,
+		DialContext:           dialer.DialContext,
+		TLSClientConfig:       &tls.Config{InsecureSkipVerify: true},
+		TLSHandshakeTimeout:   durationOr(cfg.Timeouts.TLSHandshake, defaultTLSHandshakeTimeout),
+		ResponseHeaderTimeout: time.Duration(cfg.Timeouts.ResponseHeader),
+		MaxIdleConns:          defaultMaxIdleConns,
+		MaxIdleConnsPerHost:   cfg.Connections.MaxIdlePerHost,
+		IdleConnTimeout:       durationOr(cfg.Connections.IdleTimeout, defaultIdleConnTimeout),
+		DisableKeepAlives:     cfg.Connections.DisableKeepAlives,
+	}
+	if cfg.Connections.MaxIdle > 0 {
+		upstreamTransport.MaxIdleConns = cfg.Connections.MaxIdle
+	}
+	if cfg.Connections.HTTP2 != nil {
+		if *cfg.Connections.HTTP2 {
+			upstreamTransport.ForceAttemptHTTP2 = true
+		} else {
+			// A non-nil empty map disables HTTP/2
+			upstreamTransport.TLSNextProto = map[string]func(string, *tls.Conn) http.RoundTripper{}
+		}
+	}
+
+	return &http.Client{
+		Timeout:   durationOr(cfg.Timeouts.Overall, defaultOverallTimeout),
+		Transport: upstreamTransport,
+	}
+}
+
+// ApplyConfig sets the filters and per-upstream settings from the configuration
+// file. Upstreams without an entry keep using the shared httpClient.
+func (p *Proxy) ApplyConfig(cfg *config.Config) {
+	p.upstreamsMu.Lock()
+	defer p.upstreamsMu.Unlock()
+
+	p.config = cfg
+	p.filters = cfg.Filters
+	p.rateLimits = cfg.RateLimits
+	// Buckets of the previous rules are dropped, their limits may have changed
+	if p.limiter == nil {
+		p.limiter = newRateLimiter()
+	} else {
+		p.limiter.reset()
+	}
+	p.coalesceRules = cfg.Coalesce
+	p.upstreamConfigs = make(map[string]config.Upstream)
+	for _, upstreamConfig := range cfg.Upstreams {
+		p.upstreamConfigs[upstreamConfig.URL] = upstreamConfig
+	}
+	for upstreamURL, u := range p.upstreams {
+		u.configure(p.upstreamConfigs[upstreamURL])
+	}
+}
@@ -0,0 +1,81 @@
+package proxy
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stakater/GitWebhookProxy/pkg/config"
+	"github.com/stakater/GitWebhookProxy/pkg/providers"
+)
+
+func TestNewUpstreamClient(t *testing.T) {
+	disabled := false
+	client := newUpstreamClient(config.Upstream{
+		URL: "http://jenkins",
+		Timeouts: config.Timeouts{
+			TLSHandshake:   config.Duration(time.Second),
+			ResponseHeader: config.Duration(2 * time.Second),
+			Overall:        config.Duration(3 * time.Second),
+		},
+		Connections: config.Connections{MaxIdle: 5, MaxIdlePerHost: 2, HTTP2: &disabled},
+	})
+
+	if client.Timeout != 3*time.Second {
+		t.Errorf("Timeout = %v, want 3s", client.Timeout)
+	}
+	upstreamTransport := client.Transport.(*http.Transport)
+	if upstreamTransport.TLSHandshakeTimeout != time.Second || upstreamTransport.ResponseHeaderTimeout != 2*time.Second {
+		t.Errorf("transport timeouts = %v/%v, want 1s/2s",
+			upstreamTransport.TLSHandshakeTimeout, upstreamTransport.ResponseHeaderTimeout)
+	}
+	if upstreamTransport.MaxIdleConns != 5 || upstreamTransport.MaxIdleConnsPerHost != 2 {
+		t.Errorf("idle connections = %v/%v, want 5/2", upstreamTransport.MaxIdleConns, upstreamTransport.MaxIdleConnsPerHost)
+	}
+	if upstreamTransport.TLSNextProto == nil || upstreamTransport.ForceAttemptHTTP2 {
+		t.Errorf("HTTP/2 should be disabled")
+	}
+	if upstreamTransport.IdleConnTimeout != defaultIdleConnTimeout {
+		t.Errorf("IdleConnTimeout = %v, want default %v", upstreamTransport.IdleConnTimeout, defaultIdleConnTimeout)
+	}
+}
+
+func TestProxy_ApplyConfigUsesPerUpstreamClient(t *testing.T) {
+	release := make(chan struct{})
+	slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	defer slow.Close()
+	defer close(release)
+	fast := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer fast.Close()
+
+	p, err := NewProxy([]string{slow.URL, fast.URL}, []string{}, providers.GitlabProviderKind, "", []string{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	p.ApplyConfig(&config.Config{Upstreams: []config.Upstream{
+		{URL: slow.URL, Timeouts: config.Timeouts{Overall: config.Duration(50 * time.Millisecond)}},
+	}})
+
+	upstreams := p.upstreamStates()
+	if upstreams[0].httpClient() == httpClient {
+		t.Errorf("configured upstream should use its own client")
+	}
+	if upstreams[1].httpClient() != httpClient {
+		t.Errorf("upstream without settings should use the shared client")
+	}
+
+	start := time.Now()
+	rr := httptest.NewRecorder()
+	p.newRouter().ServeHTTP(rr, createGitlabRequest(http.MethodPost, "/post", "", proxyGitlabTestEvent, "{}"))
+	if rr.Code != http.StatusOK {
+		t.Errorf("got status %v, want %v", rr.Code, http.StatusOK)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("slow upstream was not cut off by its own timeout, took %v", elapsed)
+	}
+}
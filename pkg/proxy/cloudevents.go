@@ -0,0 +1,112 @@
+package proxy
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/stakater/GitWebhookProxy/pkg/config"
+	"github.com/stakater/GitWebhookProxy/pkg/providers"
+)
+
+const (
+	cloudEventsSpecVersion  = "1.0"
+	cloudEventsContentType  = "application/cloudevents+json"
+	defaultHookContentType  = "application/json"
+	cloudEventsHeaderPrefix = "Ce-"
+)
+
+// cloudEvent holds the attributes of a CloudEvent, in the JSON format of
+// the structured HTTP mode
+type cloudEvent struct {
+	SpecVersion     string          `json:"specversion"`
+	Type            string          `json:"type"`
+	Source          string          `json:"source"`
+	ID              string          `json:"id"`
+	Time            string          `json:"time"`
+	Subject         string          `json:"subject,omitempty"`
+	DataContentType string          `json:"datacontenttype"`
+	Data            json.RawMessage `json:"data,omitempty"`
+	DataBase64      string          `json:"data_base64,omitempty"`
+}
+
+// newCloudEvent returns the attributes of the CloudEvent for a hook: the
+// type is the provider's event, e.g. com.github.push or com.gitlab.push_hook,
+// and the source is the repository URL
+func newCloudEvent(hook *providers.Hook, normalized *providers.NormalizedEvent) cloudEvent {
+	event := cloudEvent{
+		SpecVersion:     cloudEventsSpecVersion,
+		Type:            "com." + normalized.Provider + "." + strings.ReplaceAll(strings.ToLower(string(normalized.Event)), " ", "_"),
+		Source:          normalized.Repository.WebURL,
+		ID:              normalized.DeliveryID,
+		Time:            time.Now().UTC().Format(time.RFC3339),
+		Subject:         normalized.Ref,
+		DataContentType: hook.Header("Content-Type"),
+	}
+	if len(event.Source) == 0 {
+		event.Source = "/" + normalized.Provider
+	}
+	if len(event.ID) == 0 {
+		event.ID = randomID()
+	}
+	if len(event.DataContentType) == 0 {
+		event.DataContentType = defaultHookContentType
+	}
+	return event
+}
+
+// toCloudEvent rewrites the request forwarding a hook into a CloudEvent in
+// the given HTTP mode
+func toCloudEvent(req *http.Request, mode string, hook *providers.Hook, normalized *providers.NormalizedEvent) error {
+	event := newCloudEvent(hook, normalized)
+
+	if mode == config.CloudEventsBinary {
+		req.Header.Set("Content-Type", event.DataContentType)
+		req.Header.Set(cloudEventsHeaderPrefix+"Specversion", event.SpecVersion)
+		req.Header.Set(cloudEventsHeaderPrefix+"Type", event.Type)
+		req.Header.Set(cloudEventsHeaderPrefix+"Source", event.Source)
+		req.Header.Set(cloudEventsHeaderPrefix+"Id", event.ID)
+		req.Header.Set(cloudEventsHeaderPrefix+"Time", event.Time)
+		if len(event.Subject) > 0 {
+			req.Header.Set(cloudEventsHeaderPrefix+"Subject", event.Subject)
+		}
+		return nil
+	}
+
+	// Form encoded hooks carry the JSON payload decoded from their body, like
+	// the one filters and templates see
+	if data := hook.JSON(); json.Valid(data) {
+		event.Data = json.RawMessage(data)
+		event.DataContentType = defaultHookContentType
+	} else {
+		event.DataBase64 = base64.StdEncoding.EncodeToString(hook.Payload)
+	}
+	body, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	setRequestBody(req, body)
+	req.Header.Set("Content-Type", cloudEventsContentType)
+	return nil
+}
+
+// randomID returns an event ID for hooks sent without a delivery ID
+func randomID() string {
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return time.Now().UTC().Format("20060102150405.000000000")
+	}
+	return hex.EncodeToString(id)
+}
+
+// cloudEventsMode returns the CloudEvents HTTP mode of the upstream, empty
+// when hooks are forwarded as received
+func (u *upstream) cloudEventsMode() string {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	return u.config.CloudEvents.Mode
+}
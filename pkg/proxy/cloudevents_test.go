@@ -0,0 +1,154 @@
+package proxy
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"io/ioutil"
+	"net/url"
+	"testing"
+
+	"github.com/stakater/GitWebhookProxy/pkg/config"
+	"github.com/stakater/GitWebhookProxy/pkg/providers"
+)
+
+func TestToCloudEvent(t *testing.T) {
+	payload := `{"ref":"refs/heads/main","repository":{"html_url":"https://github.com/stakater/app"}}`
+	hook := &providers.Hook{
+		Payload: []byte(payload),
+		Headers: map[string]string{
+			providers.XGitHubEvent: "push",
+			"X-GitHub-Delivery":    "72d3162e-cc78-11e3-81ab-4c9367dc0958",
+			"Content-Type":         "application/json",
+		},
+		RequestMethod: "POST",
+	}
+	normalized, err := (&providers.GithubProvider{}).Normalize(*hook)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("Structured", func(t *testing.T) {
+		req, err := newRedirectRequest(hook, "http://upstream/hook")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := toCloudEvent(req, config.CloudEventsStructured, hook, normalized); err != nil {
+			t.Fatalf("toCloudEvent() error = %v", err)
+		}
+		if got := req.Header.Get("Content-Type"); got != cloudEventsContentType {
+			t.Errorf("Content-Type = %q, want %q", got, cloudEventsContentType)
+		}
+		body, _ := ioutil.ReadAll(req.Body)
+		if req.ContentLength != int64(len(body)) {
+			t.Errorf("ContentLength = %d, want %d", req.ContentLength, len(body))
+		}
+		var event cloudEvent
+		if err := json.Unmarshal(body, &event); err != nil {
+			t.Fatalf("body is not JSON: %v", err)
+		}
+		if event.SpecVersion != "1.0" || event.Type != "com.github.push" ||
+			event.Source != "https://github.com/stakater/app" || event.ID != "72d3162e-cc78-11e3-81ab-4c9367dc0958" ||
+			event.Subject != "refs/heads/main" || event.DataContentType != "application/json" || len(event.Time) == 0 {
+			t.Errorf("attributes = %+v", event)
+		}
+		if string(event.Data) != payload {
+			t.Errorf("data = %s, want the original payload", event.Data)
+		}
+	})
+
+	t.Run("Binary", func(t *testing.T) {
+		req, err := newRedirectRequest(hook, "http://upstream/hook")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := toCloudEvent(req, config.CloudEventsBinary, hook, normalized); err != nil {
+			t.Fatalf("toCloudEvent() error = %v", err)
+		}
+		want := map[string]string{
+			"Ce-Specversion": "1.0",
+			"Ce-Type":        "com.github.push",
+			"Ce-Source":      "https://github.com/stakater/app",
+			"Ce-Id":          "72d3162e-cc78-11e3-81ab-4c9367dc0958",
+			"Ce-Subject":     "refs/heads/main",
+			"Content-Type":   "application/json",
+		}
+		for key, value := range want {
+			if got := req.Header.Get(key); got != value {
+				t.Errorf("header %s = %q, want %q", key, got, value)
+			}
+		}
+		if body, _ := ioutil.ReadAll(req.Body); string(body) != payload {
+			t.Errorf("body = %s, want the original payload", body)
+		}
+	})
+}
+
+func TestToCloudEventFormEncoded(t *testing.T) {
+	payload := `{"ref":"refs/heads/main"}`
+	hook := &providers.Hook{
+		Payload: []byte("payload=" + url.QueryEscape(payload)),
+		Data:    []byte(payload),
+		Headers: map[string]string{
+			providers.XGitHubEvent: "push",
+			"Content-Type":         "application/x-www-form-urlencoded",
+		},
+		RequestMethod: "POST",
+	}
+	normalized, err := (&providers.GithubProvider{}).Normalize(*hook)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req, err := newRedirectRequest(hook, "http://upstream/hook")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := toCloudEvent(req, config.CloudEventsStructured, hook, normalized); err != nil {
+		t.Fatalf("toCloudEvent() error = %v", err)
+	}
+	body, _ := ioutil.ReadAll(req.Body)
+	var event cloudEvent
+	if err := json.Unmarshal(body, &event); err != nil {
+		t.Fatalf("body is not JSON: %v", err)
+	}
+	if string(event.Data) != payload || len(event.DataBase64) > 0 {
+		t.Errorf("data = %s, data_base64 = %s, want the decoded JSON payload", event.Data, event.DataBase64)
+	}
+	if event.DataContentType != "application/json" {
+		t.Errorf("datacontenttype = %q, want application/json", event.DataContentType)
+	}
+}
+
+func TestNewCloudEventDefaults(t *testing.T) {
+	hook := &providers.Hook{Payload: []byte("not json"), Headers: map[string]string{}}
+	normalized := &providers.NormalizedEvent{Provider: providers.GitlabName, Event: providers.GitlabPushEvent}
+
+	event := newCloudEvent(hook, normalized)
+	if event.Type != "com.gitlab.push_hook" {
+		t.Errorf("Type = %q, want com.gitlab.push_hook", event.Type)
+	}
+	if event.Source != "/gitlab" {
+		t.Errorf("Source = %q, want /gitlab without a repository URL", event.Source)
+	}
+	if len(event.ID) != 32 {
+		t.Errorf("ID = %q, want a random ID without a delivery ID", event.ID)
+	}
+	if event.DataContentType != defaultHookContentType {
+		t.Errorf("DataContentType = %q, want %q", event.DataContentType, defaultHookContentType)
+	}
+
+	req, err := newRedirectRequest(hook, "http://upstream/hook")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := toCloudEvent(req, config.CloudEventsStructured, hook, normalized); err != nil {
+		t.Fatal(err)
+	}
+	body, _ := ioutil.ReadAll(req.Body)
+	if err := json.Unmarshal(body, &event); err != nil {
+		t.Fatal(err)
+	}
+	if data, _ := base64.StdEncoding.DecodeString(event.DataBase64); string(data) != "not json" || event.Data != nil {
+		t.Errorf("data_base64 = %q, want a non JSON payload base64 encoded", event.DataBase64)
+	}
+}
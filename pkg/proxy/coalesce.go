@@ -0,0 +1,130 @@
+package proxy
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/stakater/GitWebhookProxy/pkg/config"
+	"github.com/stakater/GitWebhookProxy/pkg/providers"
+)
+
+// pendingPush is the last push received for a repository and ref within the
+// coalescing window
+type pendingPush struct {
+	requestURL     url.URL
+	in             *filterInput
+	rateLimit      *config.RateLimitRule
+	rateLimitIndex int
+	// coalesced counts the earlier pushes this one replaced
+	coalesced int
+}
+
+// coalesceRule returns the first coalescing rule matching the path and its
+// index, or nil when pushes on the path are forwarded right away
+func (p *Proxy) coalesceRule(path string) (*config.CoalesceRule, int) {
+	p.upstreamsMu.Lock()
+	defer p.upstreamsMu.Unlock()
+	for i := range p.coalesceRules {
+		rule := &p.coalesceRules[i]
+		if len(rule.Paths) == 0 || rule.Paths.Match(path) {
+			return rule, i
+		}
+	}
+	return nil, -1
+}
+
+// coalescePush holds back pushes on paths with a coalescing rule. The first
+// push for a path, repository and ref opens the window, later ones replace
+// it, and the last one is forwarded when the window closes. It responds with 202 and
+// returns true when the push was held back.
+func (p *Proxy) coalescePush(w http.ResponseWriter, requestURL *url.URL, in *filterInput, rateLimit *config.RateLimitRule, rateLimitIndex int) bool {
+	rule, ruleIndex := p.coalesceRule(requestURL.Path)
+	event := in.normalized
+	if rule == nil || event.Kind != providers.PushEventKind || len(event.Repository.FullName) == 0 || len(event.Ref) == 0 {
+		return false
+	}
+
+	// Pushes received on different paths go to different routes, so each
+	// path coalesces on its own even when a rule covers several
+	key := fmt.Sprintf("%d/%s/%s/%s", ruleIndex, requestURL.Path, event.Repository.FullName, event.Ref)
+	push := &pendingPush{
+		requestURL:     *requestURL,
+		in:             in,
+		rateLimit:      rateLimit,
+		rateLimitIndex: rateLimitIndex,
+	}
+
+	p.pushesMu.Lock()
+	if pending, ok := p.pendingPushes[key]; ok {
+		push.coalesced = pending.coalesced + 1
+		p.pendingPushes[key] = push
+		p.pushesMu.Unlock()
+
+		log.Printf("Coalescing push to '%s' of '%s' with %d earlier push(es)", event.Ref, event.Repository.FullName, push.coalesced)
+		w.WriteHeader(http.StatusAccepted)
+		w.Write([]byte(fmt.Sprintf("Coalesced push to '%s' of '%s' with %d earlier push(es), the latest is forwarded when the window closes",
+			event.Ref, event.Repository.FullName, push.coalesced)))
+		return true
+	}
+	// The delayed delivery counts as in flight so that Shutdown waits for it.
+	// Once the listeners are closed, pushes are forwarded right away instead.
+	if !p.beginDelivery() {
+		p.pushesMu.Unlock()
+		return false
+	}
+	if p.pendingPushes == nil {
+		p.pendingPushes = make(map[string]*pendingPush)
+	}
+	p.pendingPushes[key] = push
+	p.pushesMu.Unlock()
+
+	window := time.Duration(rule.Window)
+	go p.flushPush(key, window)
+
+	log.Printf("Holding back push to '%s' of '%s' for %s", event.Ref, event.Repository.FullName, window)
+	w.WriteHeader(http.StatusAccepted)
+	w.Write([]byte(fmt.Sprintf("Holding back push to '%s' of '%s' for %s to coalesce later pushes",
+		event.Ref, event.Repository.FullName, window)))
+	return true
+}
+
+// flushPush forwards the last push for key once the window closes, or right
+// away when the proxy shuts down
+func (p *Proxy) flushPush(key string, window time.Duration) {
+	defer p.endDelivery()
+
+	timer := time.NewTimer(window)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+	case <-p.stopped():
+	}
+
+	p.pushesMu.Lock()
+	push := p.pendingPushes[key]
+	delete(p.pendingPushes, key)
+	p.pushesMu.Unlock()
+
+	event := push.in.normalized
+	started := time.Now()
+	log.Printf("Forwarding push to '%s' of '%s' at '%s', coalesced with %d earlier push(es)",
+		event.Ref, event.Repository.FullName, event.After, push.coalesced)
+	result := p.fanOut(&push.requestURL, push.in, push.rateLimit, push.rateLimitIndex)
+	p.recordCoalescedPush(push, result, started)
+	for i, resp := range result.responses {
+		switch {
+		case result.errors[i] != nil:
+			log.Printf("Error redirecting coalesced push to upstream '%s': %s\n", result.upstreams[i].url, result.errors[i])
+		case resp.StatusCode >= 400:
+			log.Printf("Upstream '%s' returned error status for coalesced push: %s\n", result.upstreams[i].url, resp.Status)
+		default:
+			log.Printf("Successfully redirected coalesced push to upstream '%s' with status %s\n", result.upstreams[i].url, resp.Status)
+		}
+		if resp != nil && resp.Body != nil {
+			resp.Body.Close()
+		}
+	}
+}
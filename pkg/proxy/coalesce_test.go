@@ -0,0 +1,121 @@
+package proxy
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stakater/GitWebhookProxy/pkg/config"
+	"github.com/stakater/GitWebhookProxy/pkg/providers"
+)
+
+// recordingUpstream records the after SHA of every push it receives
+type recordingUpstream struct {
+	mu     sync.Mutex
+	afters []string
+}
+
+func (u *recordingUpstream) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var payload struct {
+		After string `json:"after"`
+	}
+	json.NewDecoder(r.Body).Decode(&payload)
+	u.mu.Lock()
+	u.afters = append(u.afters, payload.After)
+	u.mu.Unlock()
+	w.WriteHeader(http.StatusOK)
+}
+
+func (u *recordingUpstream) received() []string {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	afters := append([]string{}, u.afters...)
+	sort.Strings(afters)
+	return afters
+}
+
+func newCoalescingProxy(t *testing.T, upstreamURL string, window time.Duration) *Proxy {
+	p, err := NewProxy([]string{upstreamURL}, []string{}, providers.GitlabProviderKind, "", []string{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	p.ApplyConfig(&config.Config{Coalesce: []config.CoalesceRule{{
+		Paths:  mustParsePatterns(t, "/ci/**"),
+		Window: config.Duration(window),
+	}}})
+	return p
+}
+
+func gitlabPush(path string, ref string, after string) *http.Request {
+	return createGitlabRequest(http.MethodPost, path, "", string(providers.GitlabPushEvent),
+		`{"ref":"`+ref+`","after":"`+after+`","project":{"path_with_namespace":"group/app"}}`)
+}
+
+func TestProxy_coalescePush(t *testing.T) {
+	upstream := &recordingUpstream{}
+	server := httptest.NewServer(upstream)
+	defer server.Close()
+	p := newCoalescingProxy(t, server.URL, 200*time.Millisecond)
+	defer p.Shutdown(context.Background(), 0)
+	router := p.newRouter()
+
+	requests := []struct {
+		req  *http.Request
+		want int
+	}{
+		{gitlabPush("/ci/hook", "refs/heads/main", "a1"), http.StatusAccepted},
+		{gitlabPush("/ci/hook", "refs/heads/main", "a2"), http.StatusAccepted},
+		{gitlabPush("/ci/hook", "refs/heads/feature", "b1"), http.StatusAccepted},
+		{gitlabPush("/ci/hook", "refs/heads/main", "a3"), http.StatusAccepted},
+		// The same ref on another path of the rule goes to another route
+		{gitlabPush("/ci/other", "refs/heads/main", "d1"), http.StatusAccepted},
+		// Other paths are not coalesced
+		{gitlabPush("/other", "refs/heads/main", "c1"), http.StatusOK},
+	}
+	for i, r := range requests {
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, r.req)
+		if rr.Code != r.want {
+			t.Errorf("request #%d got %v %q, want %v", i+1, rr.Code, rr.Body.String(), r.want)
+		}
+	}
+	if got := upstream.received(); len(got) != 1 || got[0] != "c1" {
+		t.Fatalf("received %v before the window closed, want only [c1]", got)
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for len(upstream.received()) < 4 && time.Now().Before(deadline) {
+		time.Sleep(20 * time.Millisecond)
+	}
+	if got := upstream.received(); len(got) != 4 || got[0] != "a3" || got[1] != "b1" || got[3] != "d1" {
+		t.Errorf("received %v, want the last push of each path and ref [a3 b1 c1 d1]", got)
+	}
+}
+
+func TestProxy_coalescePushFlushedOnShutdown(t *testing.T) {
+	upstream := &recordingUpstream{}
+	server := httptest.NewServer(upstream)
+	defer server.Close()
+	p := newCoalescingProxy(t, server.URL, time.Hour)
+	router := p.newRouter()
+
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, gitlabPush("/ci/hook", "refs/heads/main", "a1"))
+	if rr.Code != http.StatusAccepted {
+		t.Fatalf("got %v, want the push held back", rr.Code)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := p.Shutdown(ctx, 0); err != nil {
+		t.Fatalf("Shutdown() error = %v", err)
+	}
+	if got := upstream.received(); len(got) != 1 || got[0] != "a1" {
+		t.Errorf("received %v after Shutdown, want the held back push [a1]", got)
+	}
+}
@@ -0,0 +1,420 @@
+package proxy
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	defaultDeliveryLogSize = 100
+	// maxRecordedPayload bounds the payloads kept for replaying, larger ones
+	// are dropped from the entry
+	maxRecordedPayload = 1 << 20
+	// maxRecordedReason bounds the response body kept as the reason
+	maxRecordedReason = 512
+)
+
+// Decisions of the proxy about a delivery
+const (
+	DecisionForwarded = "forwarded"
+	DecisionIgnored   = "ignored"
+	DecisionRejected  = "rejected"
+	// DecisionCoalesced pushes were held back, the last one of a ref is
+	// recorded again as forwarded once the coalescing window closes
+	DecisionCoalesced = "coalesced"
+)
+
+// Delivery is a hook received by the proxy and what became of it
+type Delivery struct {
+	ID string `json:"id"`
+	// DeliveryID is the ID sent by the provider, e.g. X-GitHub-Delivery
+	DeliveryID string    `json:"deliveryID,omitempty"`
+	Time       time.Time `json:"time"`
+	Provider   string    `json:"provider"`
+	Event      string    `json:"event,omitempty"`
+	Path       string    `json:"path"`
+	Repository string    `json:"repository,omitempty"`
+	Ref        string    `json:"ref,omitempty"`
+	Committer  string    `json:"committer,omitempty"`
+	Decision   string    `json:"decision"`
+	Reason     string    `json:"reason,omitempty"`
+	// Status is the status code the provider was answered with, 0 for
+	// coalesced pushes forwarded once their window closed
+	Status     int                `json:"status,omitempty"`
+	DurationMs float64            `json:"durationMs"`
+	Upstreams  []UpstreamDelivery `json:"upstreams,omitempty"`
+
+	// Method, Headers and Payload are kept to replay the hook. Headers that
+	// may hold secrets, like X-Gitlab-Token, are redacted.
+	Method  string            `json:"method,omitempty"`
+	Headers map[string]string `json:"headers,omitempty"`
+	Payload []byte            `json:"payload,omitempty"`
+}
+
+// UpstreamDelivery is the outcome of forwarding a hook to one upstream
+type UpstreamDelivery struct {
+	URL       string  `json:"url"`
+	Status    int     `json:"status,omitempty"`
+	Error     string  `json:"error,omitempty"`
+	LatencyMs float64 `json:"latencyMs"`
+}
+
+// DeliveryLogOptions configures the log of recent deliveries
+type DeliveryLogOptions struct {
+	// Size is the number of deliveries kept
+	Size int
+	// File persists the deliveries across restarts when set
+	File string
+}
+
+// deliveryLog keeps the last deliveries in a ring buffer
+type deliveryLog struct {
+	mu      sync.Mutex
+	entries []*Delivery
+	next    int
+	count   int
+
+	file string
+	// fileEntries counts the entries in file, which is compacted once it
+	// holds twice as many as the ring
+	fileEntries int
+}
+
+// EnableDeliveryLog starts recording deliveries, see DeliveryLogOptions. The
+// deliveries persisted in the file are loaded.
+func (p *Proxy) EnableDeliveryLog(opts DeliveryLogOptions) error {
+	if opts.Size <= 0 {
+		opts.Size = defaultDeliveryLogSize
+	}
+	deliveries := &deliveryLog{
+		entries: make([]*Delivery, opts.Size),
+		file:    opts.File,
+	}
+	if len(opts.File) > 0 {
+		if err := deliveries.load(); err != nil {
+			return fmt.Errorf("Error loading deliveries from '%s': %s", opts.File, err)
+		}
+	}
+	p.deliveries = deliveries
+	return nil
+}
+
+func (l *deliveryLog) load() error {
+	file, err := os.Open(l.file)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 4*maxRecordedPayload)
+	for scanner.Scan() {
+		if len(strings.TrimSpace(scanner.Text())) == 0 {
+			continue
+		}
+		var delivery Delivery
+		if err := json.Unmarshal(scanner.Bytes(), &delivery); err != nil {
+			return err
+		}
+		l.push(&delivery)
+		l.fileEntries++
+	}
+	return scanner.Err()
+}
+
+// add records a delivery and appends it to the file
+func (l *deliveryLog) add(delivery *Delivery) {
+	if l == nil {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.push(delivery)
+
+	if len(l.file) == 0 {
+		return
+	}
+	var err error
+	if l.fileEntries >= 2*len(l.entries) {
+		err = l.compact()
+	} else {
+		err = l.appendToFile(delivery)
+	}
+	if err != nil {
+		log.Printf("Error persisting deliveries to '%s': %s", l.file, err)
+	}
+}
+
+func (l *deliveryLog) push(delivery *Delivery) {
+	l.entries[l.next] = delivery
+	l.next = (l.next + 1) % len(l.entries)
+	if l.count < len(l.entries) {
+		l.count++
+	}
+}
+
+func (l *deliveryLog) appendToFile(delivery *Delivery) error {
+	data, err := json.Marshal(delivery)
+	if err != nil {
+		return err
+	}
+	file, err := os.OpenFile(l.file, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	if _, err := file.Write(append(data, '\n')); err != nil {
+		file.Close()
+		return err
+	}
+	l.fileEntries++
+	return file.Close()
+}
+
+// compact rewrites the file with the entries of the ring only
+func (l *deliveryLog) compact() error {
+	var lines []byte
+	entries := l.oldestFirst()
+	for _, delivery := range entries {
+		data, err := json.Marshal(delivery)
+		if err != nil {
+			return err
+		}
+		lines = append(lines, data...)
+		lines = append(lines, '\n')
+	}
+
+	tmp, err := ioutil.TempFile(filepath.Dir(l.file), filepath.Base(l.file)+".*")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(lines); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := os.Rename(tmp.Name(), l.file); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	l.fileEntries = len(entries)
+	return nil
+}
+
+func (l *deliveryLog) oldestFirst() []*Delivery {
+	entries := make([]*Delivery, 0, l.count)
+	start := (l.next - l.count + len(l.entries)) % len(l.entries)
+	for i := 0; i < l.count; i++ {
+		entries = append(entries, l.entries[(start+i)%len(l.entries)])
+	}
+	return entries
+}
+
+// list returns the recorded deliveries, newest first
+func (l *deliveryLog) list() []*Delivery {
+	if l == nil {
+		return nil
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	entries := l.oldestFirst()
+	for i, j := 0, len(entries)-1; i < j; i, j = i+1, j-1 {
+		entries[i], entries[j] = entries[j], entries[i]
+	}
+	return entries
+}
+
+// find returns the newest delivery with the ID, or with the delivery ID of
+// the provider
+func (l *deliveryLog) find(id string) *Delivery {
+	for _, delivery := range l.list() {
+		if delivery.ID == id || delivery.DeliveryID == id {
+			return delivery
+		}
+	}
+	return nil
+}
+
+// deliveryRecorder records the delivery of the request it wraps the
+// response writer of
+type deliveryRecorder struct {
+	http.ResponseWriter
+	log      *deliveryLog
+	started  time.Time
+	delivery *Delivery
+	status   int
+	body     []byte
+}
+
+// recordDelivery starts recording the delivery of a request, nil when the
+// delivery log is disabled. The methods of a nil recorder do nothing.
+func (p *Proxy) recordDelivery(w http.ResponseWriter, r *http.Request) *deliveryRecorder {
+	if p.deliveries == nil {
+		return nil
+	}
+	now := time.Now()
+	return &deliveryRecorder{
+		ResponseWriter: w,
+		log:            p.deliveries,
+		started:        now,
+		delivery: &Delivery{
+			ID:       randomID(),
+			Time:     now.UTC(),
+			Provider: p.provider,
+			Path:     r.URL.Path,
+			Method:   r.Method,
+		},
+	}
+}
+
+func (rec *deliveryRecorder) WriteHeader(status int) {
+	if rec.status == 0 {
+		rec.status = status
+	}
+	rec.ResponseWriter.WriteHeader(status)
+}
+
+func (rec *deliveryRecorder) Write(data []byte) (int, error) {
+	if rec.status == 0 {
+		rec.status = http.StatusOK
+	}
+	if room := maxRecordedReason - len(rec.body); room > 0 {
+		if len(data) < room {
+			room = len(data)
+		}
+		rec.body = append(rec.body, data[:room]...)
+	}
+	return rec.ResponseWriter.Write(data)
+}
+
+// setHook records the hook and the event it was parsed into
+func (rec *deliveryRecorder) setHook(in *filterInput) {
+	if rec == nil {
+		return
+	}
+	describeHook(rec.delivery, in)
+}
+
+// setUpstreams records the outcome of forwarding the hook to the upstreams
+func (rec *deliveryRecorder) setUpstreams(result *fanOutResult) {
+	if rec == nil {
+		return
+	}
+	rec.delivery.Upstreams = upstreamDeliveries(result)
+}
+
+// setDecision overrides the decision derived from the response
+func (rec *deliveryRecorder) setDecision(decision string) {
+	if rec == nil {
+		return
+	}
+	rec.delivery.Decision = decision
+}
+
+// finish adds the delivery to the log once the response is written
+func (rec *deliveryRecorder) finish() {
+	if rec == nil {
+		return
+	}
+	delivery := rec.delivery
+	delivery.Status = rec.status
+	delivery.DurationMs = milliseconds(time.Since(rec.started))
+
+	reason := strings.TrimSpace(string(rec.body))
+	if len(delivery.Decision) == 0 {
+		switch {
+		case len(delivery.Upstreams) > 0:
+			delivery.Decision = DecisionForwarded
+		case rec.status >= 400:
+			delivery.Decision = DecisionRejected
+		default:
+			delivery.Decision = DecisionIgnored
+		}
+	}
+	// The body of a successful upstream response is not a reason
+	if delivery.Decision != DecisionForwarded || rec.status >= 400 {
+		delivery.Reason = reason
+	}
+	rec.log.add(delivery)
+}
+
+// describeHook fills the fields of a delivery read from the hook
+func describeHook(delivery *Delivery, in *filterInput) {
+	delivery.Event = string(in.event)
+	if in.normalized != nil {
+		delivery.DeliveryID = in.normalized.DeliveryID
+		delivery.Repository = in.normalized.Repository.FullName
+		delivery.Ref = in.normalized.Ref
+		delivery.Committer = in.normalized.Actor.Login
+	}
+	if in.hook == nil {
+		return
+	}
+	delivery.Method = in.hook.RequestMethod
+	delivery.Headers = make(map[string]string, len(in.hook.Headers))
+	for name, value := range in.hook.Headers {
+		if isSensitiveName(name) {
+			value = Redacted
+		}
+		delivery.Headers[name] = value
+	}
+	if len(in.hook.Payload) <= maxRecordedPayload {
+		delivery.Payload = in.hook.Payload
+	}
+}
+
+func upstreamDeliveries(result *fanOutResult) []UpstreamDelivery {
+	deliveries := make([]UpstreamDelivery, 0, len(result.upstreams))
+	for i, upstream := range result.upstreams {
+		delivery := UpstreamDelivery{
+			URL:       redactURL(upstream.url),
+			LatencyMs: milliseconds(result.latencies[i]),
+		}
+		if result.errors[i] != nil {
+			delivery.Error = result.errors[i].Error()
+		} else if result.responses[i] != nil {
+			delivery.Status = result.responses[i].StatusCode
+		}
+		deliveries = append(deliveries, delivery)
+	}
+	return deliveries
+}
+
+// recordCoalescedPush records the delivery of a coalesced push once its
+// window closed
+func (p *Proxy) recordCoalescedPush(push *pendingPush, result *fanOutResult, started time.Time) {
+	if p.deliveries == nil {
+		return
+	}
+	delivery := &Delivery{
+		ID:         randomID(),
+		Time:       started.UTC(),
+		Provider:   p.provider,
+		Path:       push.requestURL.Path,
+		Decision:   DecisionForwarded,
+		Reason:     fmt.Sprintf("Coalesced with %d earlier push(es)", push.coalesced),
+		DurationMs: milliseconds(time.Since(started)),
+		Upstreams:  upstreamDeliveries(result),
+	}
+	describeHook(delivery, push.in)
+	p.deliveries.add(delivery)
+}
+
+func milliseconds(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
@@ -0,0 +1,171 @@
+package proxy
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stakater/GitWebhookProxy/pkg/config"
+	"github.com/stakater/GitWebhookProxy/pkg/providers"
+)
+
+func deliveryIDs(deliveries []*Delivery) []string {
+	ids := []string{}
+	for _, delivery := range deliveries {
+		ids = append(ids, delivery.ID)
+	}
+	return ids
+}
+
+func TestDeliveryLog_ring(t *testing.T) {
+	p := &Proxy{}
+	if err := p.EnableDeliveryLog(DeliveryLogOptions{Size: 3}); err != nil {
+		t.Fatal(err)
+	}
+	for _, id := range []string{"1", "2", "3", "4", "5"} {
+		p.deliveries.add(&Delivery{ID: id, DeliveryID: "github-" + id})
+	}
+
+	if got := strings.Join(deliveryIDs(p.deliveries.list()), ","); got != "5,4,3" {
+		t.Errorf("list() = %v, want the last 3 deliveries newest first 5,4,3", got)
+	}
+	if got := p.deliveries.find("github-4"); got == nil || got.ID != "4" {
+		t.Errorf("find() by provider delivery ID = %v, want delivery 4", got)
+	}
+	if got := p.deliveries.find("1"); got != nil {
+		t.Errorf("find() = %v for a dropped delivery, want nil", got)
+	}
+}
+
+func TestDeliveryLog_persisted(t *testing.T) {
+	dir, err := ioutil.TempDir("", "deliveries")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "deliveries.jsonl")
+
+	p := &Proxy{}
+	if err := p.EnableDeliveryLog(DeliveryLogOptions{Size: 2, File: file}); err != nil {
+		t.Fatal(err)
+	}
+	for _, id := range []string{"1", "2", "3", "4", "5"} {
+		p.deliveries.add(&Delivery{ID: id, Payload: []byte(`{"ref":"refs/heads/main"}`)})
+	}
+
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if lines := strings.Count(string(data), "\n"); lines > 4 {
+		t.Errorf("file holds %d deliveries, want it compacted to at most 4", lines)
+	}
+
+	restarted := &Proxy{}
+	if err := restarted.EnableDeliveryLog(DeliveryLogOptions{Size: 2, File: file}); err != nil {
+		t.Fatal(err)
+	}
+	deliveries := restarted.deliveries.list()
+	if got := strings.Join(deliveryIDs(deliveries), ","); got != "5,4" {
+		t.Errorf("loaded %v, want 5,4", got)
+	}
+	if len(deliveries) > 0 && string(deliveries[0].Payload) != `{"ref":"refs/heads/main"}` {
+		t.Errorf("loaded payload %q", deliveries[0].Payload)
+	}
+}
+
+func TestProxy_proxyRequestRecordsDeliveries(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte("queued"))
+	}))
+	defer upstream.Close()
+
+	p, err := NewProxy([]string{upstream.URL}, []string{"/ci"}, providers.GitlabProviderKind, "token", []string{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	p.ApplyConfig(&config.Config{Filters: config.Filters{Refs: mustParsePatterns(t, "refs/heads/main")}})
+	if err := p.EnableDeliveryLog(DeliveryLogOptions{Size: 10}); err != nil {
+		t.Fatal(err)
+	}
+
+	push := func(path string, token string, ref string) *http.Request {
+		return createGitlabRequest(http.MethodPost, path, token, string(providers.GitlabPushEvent),
+			`{"ref":"`+ref+`","user_username":"jdoe","project":{"path_with_namespace":"group/app"}}`)
+	}
+	tests := []struct {
+		name       string
+		req        *http.Request
+		decision   string
+		reason     string
+		status     int
+		upstreamOK bool
+	}{
+		{"Forwarded", push("/ci/hook", "token", "refs/heads/main"), DecisionForwarded, "", http.StatusCreated, true},
+		{"Ignored", push("/ci/hook", "token", "refs/heads/feature"), DecisionIgnored, "ref 'refs/heads/feature' does not match the ref filters", http.StatusOK, false},
+		{"RejectedSignature", push("/ci/hook", "wrong", "refs/heads/main"), DecisionRejected, "Error validating Hook", http.StatusBadRequest, false},
+		{"RejectedPath", push("/other", "token", "refs/heads/main"), DecisionRejected, "Not allowed to proxy path", http.StatusForbidden, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p.newRouter().ServeHTTP(httptest.NewRecorder(), tt.req)
+
+			delivery := p.deliveries.list()[0]
+			if delivery.Decision != tt.decision || delivery.Status != tt.status {
+				t.Errorf("recorded %v with status %v, want %v with %v", delivery.Decision, delivery.Status, tt.decision, tt.status)
+			}
+			if !strings.Contains(delivery.Reason, tt.reason) || (len(tt.reason) == 0 && len(delivery.Reason) > 0) {
+				t.Errorf("recorded reason %q, want %q", delivery.Reason, tt.reason)
+			}
+			if tt.upstreamOK && (len(delivery.Upstreams) != 1 || delivery.Upstreams[0].Status != http.StatusCreated) {
+				t.Errorf("recorded upstreams %+v, want %v from %s", delivery.Upstreams, http.StatusCreated, upstream.URL)
+			}
+			if tt.name != "RejectedPath" && (delivery.Repository != "group/app" || delivery.Committer != "jdoe" || delivery.Event != string(providers.GitlabPushEvent)) {
+				t.Errorf("recorded %+v, want the repository, committer and event of the push", delivery)
+			}
+			if token := delivery.Headers[providers.XGitlabToken]; tt.name != "RejectedPath" && token != Redacted {
+				t.Errorf("recorded the GitLab token %q, want it redacted", token)
+			}
+		})
+	}
+}
+
+func TestProxy_adminDeliveries(t *testing.T) {
+	p := &Proxy{}
+	if err := p.EnableDeliveryLog(DeliveryLogOptions{Size: 10}); err != nil {
+		t.Fatal(err)
+	}
+	p.deliveries.add(&Delivery{ID: "1", Repository: "group/app", Decision: DecisionForwarded, Payload: []byte("{}")})
+	p.deliveries.add(&Delivery{ID: "2", Repository: "group/lib", Decision: DecisionIgnored, Reason: "<script>"})
+	admin := p.newAdminRouter(AdminOptions{Token: testAdminToken})
+
+	var deliveries []Delivery
+	rr := adminRequest(t, admin, http.MethodGet, "/deliveries?decision=forwarded")
+	if err := json.Unmarshal(rr.Body.Bytes(), &deliveries); err != nil {
+		t.Fatalf("GET /deliveries returned invalid JSON %q: %v", rr.Body.String(), err)
+	}
+	if len(deliveries) != 1 || deliveries[0].ID != "1" || deliveries[0].Payload != nil {
+		t.Errorf("GET /deliveries returned %+v, want delivery 1 without its payload", deliveries)
+	}
+
+	var delivery Delivery
+	rr = adminRequest(t, admin, http.MethodGet, "/deliveries/1")
+	if err := json.Unmarshal(rr.Body.Bytes(), &delivery); err != nil || string(delivery.Payload) != "{}" {
+		t.Errorf("GET /deliveries/1 returned %v %q, want the delivery with its payload", rr.Code, rr.Body.String())
+	}
+	if rr := adminRequest(t, admin, http.MethodGet, "/deliveries/3"); rr.Code != http.StatusNotFound {
+		t.Errorf("GET /deliveries/3 returned %v, want %v", rr.Code, http.StatusNotFound)
+	}
+
+	rr = adminRequest(t, admin, http.MethodGet, "/")
+	page := rr.Body.String()
+	if rr.Code != http.StatusOK || !strings.Contains(page, "group/lib") || !strings.Contains(page, "&lt;script&gt;") {
+		t.Errorf("GET / returned %v, want both deliveries escaped:\n%s", rr.Code, page)
+	}
+}
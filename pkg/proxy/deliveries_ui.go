@@ -0,0 +1,138 @@
+package proxy
+
+import (
+	"fmt"
+	"html/template"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/julienschmidt/httprouter"
+)
+
+// deliveriesPage lists the recent deliveries, newest first
+var deliveriesPage = template.Must(template.New("deliveries").Funcs(template.FuncMap{
+	"latency": func(ms float64) string { return fmt.Sprintf("%.1f ms", ms) },
+}).Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>GitWebhookProxy - Recent Deliveries</title>
+<style>
+body { font-family: sans-serif; font-size: 14px; margin: 1em 2em; }
+table { border-collapse: collapse; width: 100%; }
+th, td { border-bottom: 1px solid #ddd; padding: 4px 8px; text-align: left; vertical-align: top; }
+th { background: #f4f4f4; }
+.forwarded { color: #1a7f37; }
+.ignored { color: #6e7781; }
+.rejected { color: #cf222e; }
+.coalesced { color: #9a6700; }
+.error { color: #cf222e; }
+form input, form select { margin-right: 1em; }
+</style>
+</head>
+<body>
+<h1>Recent Deliveries</h1>
+{{if not .Enabled}}<p>The delivery log is disabled, set <code>deliveryLogSize</code> to record deliveries.</p>{{end}}
+<form method="get">
+<label>Repository <input name="repository" value="{{.Query.Repository}}"></label>
+<label>Event <input name="event" value="{{.Query.Event}}"></label>
+<label>Decision <select name="decision">
+<option value="">any</option>
+{{range .Decisions}}<option{{if eq . $.Query.Decision}} selected{{end}}>{{.}}</option>{{end}}
+</select></label>
+<input type="submit" value="Filter">
+</form>
+<p>{{len .Deliveries}} deliveries</p>
+<table>
+<tr><th>Time (UTC)</th><th>Provider</th><th>Event</th><th>Repository</th><th>Ref</th><th>Path</th><th>Committer</th><th>Decision</th><th>Status</th><th>Upstreams</th><th>ID</th></tr>
+{{range .Deliveries}}<tr>
+<td>{{.Time.Format "2006-01-02 15:04:05"}}</td>
+<td>{{.Provider}}</td>
+<td>{{.Event}}</td>
+<td>{{.Repository}}</td>
+<td>{{.Ref}}</td>
+<td>{{.Path}}</td>
+<td>{{.Committer}}</td>
+<td class="{{.Decision}}">{{.Decision}}{{if .Reason}}<br><small>{{.Reason}}</small>{{end}}</td>
+<td>{{if .Status}}{{.Status}}{{end}}<br><small>{{latency .DurationMs}}</small></td>
+<td>{{range .Upstreams}}<div>{{.URL}}: {{if .Error}}<span class="error">{{.Error}}</span>{{else}}{{.Status}}{{end}} <small>{{latency .LatencyMs}}</small></div>{{end}}</td>
+<td><a href="deliveries/{{.ID}}">{{.ID}}</a></td>
+</tr>{{end}}
+</table>
+</body>
+</html>
+`))
+
+// deliveryQuery filters the deliveries listed, empty fields match any
+type deliveryQuery struct {
+	Repository string
+	Event      string
+	Decision   string
+}
+
+func newDeliveryQuery(r *http.Request) deliveryQuery {
+	query := r.URL.Query()
+	return deliveryQuery{
+		Repository: strings.TrimSpace(query.Get("repository")),
+		Event:      strings.TrimSpace(query.Get("event")),
+		Decision:   strings.TrimSpace(query.Get("decision")),
+	}
+}
+
+func (q deliveryQuery) match(delivery *Delivery) bool {
+	return (len(q.Repository) == 0 || strings.EqualFold(q.Repository, delivery.Repository)) &&
+		(len(q.Event) == 0 || strings.EqualFold(q.Event, delivery.Event)) &&
+		(len(q.Decision) == 0 || q.Decision == delivery.Decision)
+}
+
+// deliverySummaries returns the deliveries matching the query without their
+// headers and payload
+func (p *Proxy) deliverySummaries(q deliveryQuery) []Delivery {
+	summaries := []Delivery{}
+	for _, delivery := range p.deliveries.list() {
+		if q.match(delivery) {
+			summary := *delivery
+			summary.Headers = nil
+			summary.Payload = nil
+			summaries = append(summaries, summary)
+		}
+	}
+	return summaries
+}
+
+func (p *Proxy) adminDeliveriesPage(w http.ResponseWriter, r *http.Request, params httprouter.Params) {
+	q := newDeliveryQuery(r)
+	data := struct {
+		Enabled    bool
+		Query      deliveryQuery
+		Decisions  []string
+		Deliveries []Delivery
+	}{
+		Enabled:    p.deliveries != nil,
+		Query:      q,
+		Decisions:  []string{DecisionForwarded, DecisionIgnored, DecisionRejected, DecisionCoalesced},
+		Deliveries: p.deliverySummaries(q),
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if err := deliveriesPage.Execute(w, data); err != nil {
+		log.Printf("Error rendering deliveries page: %s", err)
+	}
+}
+
+func (p *Proxy) adminDeliveries(w http.ResponseWriter, r *http.Request, params httprouter.Params) {
+	writeJSON(w, http.StatusOK, p.deliverySummaries(newDeliveryQuery(r)))
+}
+
+func (p *Proxy) adminDelivery(w http.ResponseWriter, r *http.Request, params httprouter.Params) {
+	if p.deliveries == nil {
+		http.Error(w, "The delivery log is disabled", http.StatusNotFound)
+		return
+	}
+	delivery := p.deliveries.find(params.ByName("id"))
+	if delivery == nil {
+		http.Error(w, fmt.Sprintf("Delivery '%s' not found", params.ByName("id")), http.StatusNotFound)
+		return
+	}
+	writeJSON(w, http.StatusOK, delivery)
+}
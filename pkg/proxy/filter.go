@@ -0,0 +1,225 @@
+package proxy
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/stakater/GitWebhookProxy/pkg/config"
+	"github.com/stakater/GitWebhookProxy/pkg/providers"
+)
+
+// filterInput is what the filters of the configuration file match a hook against
+type filterInput struct {
+	event providers.Event
+	// refs are the full refs of the hook: the pushed ref, or the base and
+	// head branches of a pull or merge request
+	refs []string
+	// files are the paths touched by the commits of a push, nil for other hooks
+	files []string
+	// commitMessages of a push, the head commit last
+	commitMessages []string
+
+	normalized *providers.NormalizedEvent
+	hook       *providers.Hook
+	// envMu guards env and templateEnv, templates of several upstreams are
+	// executed concurrently
+	envMu sync.Mutex
+	// env holds the variables of filter expressions, built on first use
+	env map[string]interface{}
+	// templateEnv holds the same variables for templates, built on first use
+	templateEnv map[string]interface{}
+}
+
+func newFilterInput(provider providers.Provider, hook *providers.Hook) *filterInput {
+	event := provider.GetEventType(*hook)
+	normalized, err := provider.Normalize(*hook)
+	if err != nil {
+		log.Printf("Payload unmarshalling for filters failed for event '%s': %v", event, err)
+		normalized = &providers.NormalizedEvent{
+			Provider: provider.GetProviderName(),
+			Event:    event,
+			Kind:     providers.OtherEventKind,
+		}
+	}
+
+	in := &filterInput{
+		event:      event,
+		refs:       normalized.Refs(),
+		files:      normalized.ChangedFiles,
+		normalized: normalized,
+		hook:       hook,
+	}
+	for _, commit := range normalized.Commits {
+		in.commitMessages = append(in.commitMessages, commit.Message)
+	}
+	return in
+}
+
+// expressionEnv returns the values of config.ExpressionVariables. Headers are
+// keyed by their canonical name, e.g. X-Github-Event.
+func (in *filterInput) expressionEnv() map[string]interface{} {
+	in.envMu.Lock()
+	defer in.envMu.Unlock()
+	if in.env == nil {
+		in.env = in.newEnv(false)
+	}
+	return in.env
+}
+
+// templateVariables returns the variables of expressionEnv with numbers
+// decoded as json.Number, so that templates render an id like 123456789 as
+// is rather than as the float 1.23456789e+08
+func (in *filterInput) templateVariables() map[string]interface{} {
+	in.envMu.Lock()
+	defer in.envMu.Unlock()
+	if in.templateEnv == nil {
+		in.templateEnv = in.newEnv(true)
+	}
+	return in.templateEnv
+}
+
+func (in *filterInput) newEnv(useNumber bool) map[string]interface{} {
+	decode := func(data []byte, v interface{}) error {
+		decoder := json.NewDecoder(bytes.NewReader(data))
+		if useNumber {
+			decoder.UseNumber()
+		}
+		return decoder.Decode(v)
+	}
+
+	headers := make(map[string]interface{})
+	var payload, normalized interface{}
+	if in.normalized != nil {
+		// Round-trip through JSON so that expressions see the JSON field names
+		data, err := json.Marshal(in.normalized)
+		if err == nil {
+			err = decode(data, &normalized)
+		}
+		if err != nil {
+			log.Printf("Normalized event encoding for filter expressions failed: %v", err)
+		}
+	}
+	if in.hook != nil {
+		for key, value := range in.hook.Headers {
+			headers[http.CanonicalHeaderKey(key)] = value
+		}
+		if err := decode(in.hook.JSON(), &payload); err != nil {
+			log.Printf("Payload unmarshalling for filter expressions failed: %v", err)
+		}
+	}
+	provider := ""
+	if in.normalized != nil {
+		provider = in.normalized.Provider
+	}
+	return map[string]interface{}{
+		"event":      string(in.event),
+		"provider":   provider,
+		"payload":    payload,
+		"headers":    headers,
+		"normalized": normalized,
+	}
+}
+
+func containsFold(list []string, value string) bool {
+	for _, item := range list {
+		if strings.EqualFold(item, value) {
+			return true
+		}
+	}
+	return false
+}
+
+// filterReason returns why the hook must not be forwarded, or an empty
+// string if it passes every filter
+func filterReason(filters config.Filters, in *filterInput) string {
+	event := string(in.event)
+	if containsFold(filters.Events.Deny, event) {
+		return fmt.Sprintf("event '%s' is denied", event)
+	}
+	if len(filters.Events.Allow) > 0 && !containsFold(filters.Events.Allow, event) {
+		return fmt.Sprintf("event '%s' is not allowed", event)
+	}
+	if len(filters.Refs) > 0 && len(in.refs) > 0 && !anyMatches(filters.Refs, in.refs) {
+		return fmt.Sprintf("ref '%s' does not match the ref filters", strings.Join(in.refs, "', '"))
+	}
+	if len(filters.Paths) > 0 && len(in.files) > 0 && !anyMatches(filters.Paths, in.files) {
+		return "no changed file matches the path filters"
+	}
+	if reason := skipCIReason(filters.SkipCI, in.commitMessages); len(reason) > 0 {
+		return reason
+	}
+	if filters.Expression.Program != nil {
+		matched, err := filters.Expression.Eval(in.expressionEnv())
+		if err != nil {
+			return fmt.Sprintf("expression '%s' failed: %s", filters.Expression, err)
+		}
+		if !matched {
+			return fmt.Sprintf("expression '%s' is false", filters.Expression)
+		}
+	}
+	return ""
+}
+
+// skipCIReason reports why a push is skipped when the head commit, or every
+// commit, carries one of the markers
+func skipCIReason(skipCI config.SkipCI, messages []string) string {
+	if len(skipCI.Markers) == 0 || len(messages) == 0 {
+		return ""
+	}
+	if skipCI.HeadCommitOnly {
+		messages = messages[len(messages)-1:]
+	}
+
+	marker := ""
+	for _, message := range messages {
+		marker = containedMarker(skipCI.Markers, message)
+		if len(marker) == 0 {
+			return ""
+		}
+	}
+	if skipCI.HeadCommitOnly {
+		return fmt.Sprintf("head commit message contains '%s'", marker)
+	}
+	return fmt.Sprintf("every commit message contains a skip marker like '%s'", marker)
+}
+
+func containedMarker(markers []string, message string) string {
+	message = strings.ToLower(message)
+	for _, marker := range markers {
+		if strings.Contains(message, strings.ToLower(strings.TrimSpace(marker))) {
+			return strings.TrimSpace(marker)
+		}
+	}
+	return ""
+}
+
+// anyMatches reports whether one of the values passes the patterns, so that
+// a pull request passes when either its base or head branch does and a push
+// when any of its changed files does
+func anyMatches(patterns config.Patterns, values []string) bool {
+	for _, value := range values {
+		if patterns.Match(value) {
+			return true
+		}
+	}
+	return false
+}
+
+// globalFilters returns the filters applied before fanning out to upstreams
+func (p *Proxy) globalFilters() config.Filters {
+	p.upstreamsMu.Lock()
+	defer p.upstreamsMu.Unlock()
+	return p.filters
+}
+
+// filters returns the filters of this upstream from the configuration file
+func (u *upstream) filters() config.Filters {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	return u.config.Filters
+}
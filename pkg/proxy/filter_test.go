@@ -0,0 +1,404 @@
+package proxy
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/stakater/GitWebhookProxy/pkg/config"
+	"github.com/stakater/GitWebhookProxy/pkg/providers"
+	"gopkg.in/yaml.v2"
+)
+
+func TestFilterReason_Events(t *testing.T) {
+	tests := []struct {
+		name    string
+		filters config.Filters
+		event   providers.Event
+		want    string
+	}{
+		{
+			name:  "NoFilters",
+			event: "star",
+		},
+		{
+			name:    "Allowed",
+			filters: config.Filters{Events: config.EventFilter{Allow: []string{"push", "pull_request"}}},
+			event:   "push",
+		},
+		{
+			name:    "AllowedIgnoresCase",
+			filters: config.Filters{Events: config.EventFilter{Allow: []string{"push hook"}}},
+			event:   "Push Hook",
+		},
+		{
+			name:    "NotAllowed",
+			filters: config.Filters{Events: config.EventFilter{Allow: []string{"push", "pull_request"}}},
+			event:   "star",
+			want:    "event 'star' is not allowed",
+		},
+		{
+			name:    "Denied",
+			filters: config.Filters{Events: config.EventFilter{Deny: []string{"star", "watch", "fork"}}},
+			event:   "watch",
+			want:    "event 'watch' is denied",
+		},
+		{
+			name: "DenyWinsOverAllow",
+			filters: config.Filters{Events: config.EventFilter{
+				Allow: []string{"push"},
+				Deny:  []string{"push"},
+			}},
+			event: "push",
+			want:  "event 'push' is denied",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := filterReason(tt.filters, &filterInput{event: tt.event}); got != tt.want {
+				t.Errorf("filterReason() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func mustParsePatterns(t *testing.T, sources ...string) config.Patterns {
+	patterns := config.Patterns{}
+	for _, source := range sources {
+		pattern, err := config.ParsePattern(source)
+		if err != nil {
+			t.Fatal(err)
+		}
+		patterns = append(patterns, pattern)
+	}
+	return patterns
+}
+
+func TestFilterReason_Refs(t *testing.T) {
+	filters := config.Filters{Refs: mustParsePatterns(t, "refs/heads/main", "refs/heads/release/*", "!refs/tags/*")}
+
+	tests := []struct {
+		name string
+		refs []string
+		want string
+	}{
+		{name: "Main", refs: []string{"refs/heads/main"}},
+		{name: "Release", refs: []string{"refs/heads/release/1.2"}},
+		{name: "NoRef", refs: nil},
+		{name: "PullRequestIntoMain", refs: []string{"refs/heads/main", "refs/heads/feature/x"}},
+		{
+			name: "Feature",
+			refs: []string{"refs/heads/feature/x"},
+			want: "ref 'refs/heads/feature/x' does not match the ref filters",
+		},
+		{
+			name: "Tag",
+			refs: []string{"refs/tags/v1.0"},
+			want: "ref 'refs/tags/v1.0' does not match the ref filters",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := filterReason(filters, &filterInput{event: "push", refs: tt.refs}); got != tt.want {
+				t.Errorf("filterReason() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFilterReason_Paths(t *testing.T) {
+	filters := config.Filters{Paths: mustParsePatterns(t, "services/payments/**", "!**/*.md")}
+
+	tests := []struct {
+		name  string
+		files []string
+		want  string
+	}{
+		{name: "NoCommits", files: nil},
+		{name: "PaymentsChanged", files: []string{"services/billing/main.go", "services/payments/api/main.go"}},
+		{
+			name:  "OtherServiceChanged",
+			files: []string{"services/billing/main.go"},
+			want:  "no changed file matches the path filters",
+		},
+		{
+			name:  "OnlyDocsChanged",
+			files: []string{"services/payments/README.md"},
+			want:  "no changed file matches the path filters",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := filterReason(filters, &filterInput{event: "push", files: tt.files}); got != tt.want {
+				t.Errorf("filterReason() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFilterReason_Expression(t *testing.T) {
+	var filters config.Filters
+	err := yaml.UnmarshalStrict([]byte(`
+expression: event == "pull_request" && payload.action in ["opened", "synchronize"] && !payload.pull_request.draft
+`), &filters)
+	if err != nil {
+		t.Fatal(err)
+	}
+	github, _ := providers.NewGithubProvider("")
+
+	tests := []struct {
+		name    string
+		event   string
+		payload string
+		want    string
+	}{
+		{
+			name:    "Opened",
+			event:   "pull_request",
+			payload: `{"action":"opened","pull_request":{"draft":false}}`,
+		},
+		{
+			name:    "Draft",
+			event:   "pull_request",
+			payload: `{"action":"opened","pull_request":{"draft":true}}`,
+			want:    "expression '" + filters.Expression.String() + "' is false",
+		},
+		{
+			name:    "Push",
+			event:   "push",
+			payload: `{"ref":"refs/heads/main"}`,
+			want:    "expression '" + filters.Expression.String() + "' is false",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			hook := &providers.Hook{
+				Payload: []byte(tt.payload),
+				Headers: map[string]string{providers.XGitHubEvent: tt.event},
+			}
+			if got := filterReason(filters, newFilterInput(github, hook)); got != tt.want {
+				t.Errorf("filterReason() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFilterReason_SkipCI(t *testing.T) {
+	markers := []string{"[skip ci]", "[ci skip]", "***NO_CI***"}
+
+	tests := []struct {
+		name     string
+		skipCI   config.SkipCI
+		messages []string
+		want     string
+	}{
+		{
+			name:     "Disabled",
+			messages: []string{"[skip ci] docs"},
+		},
+		{
+			name:   "NoCommits",
+			skipCI: config.SkipCI{Markers: markers},
+		},
+		{
+			name:     "EveryCommit",
+			skipCI:   config.SkipCI{Markers: markers},
+			messages: []string{"docs [skip ci]", "typo [CI SKIP]"},
+			want:     "every commit message contains a skip marker like '[ci skip]'",
+		},
+		{
+			name:     "NotEveryCommit",
+			skipCI:   config.SkipCI{Markers: markers},
+			messages: []string{"feature", "docs [skip ci]"},
+		},
+		{
+			name:     "HeadCommit",
+			skipCI:   config.SkipCI{Markers: markers, HeadCommitOnly: true},
+			messages: []string{"feature", "release ***NO_CI***"},
+			want:     "head commit message contains '***NO_CI***'",
+		},
+		{
+			name:     "HeadCommitWithoutMarker",
+			skipCI:   config.SkipCI{Markers: markers, HeadCommitOnly: true},
+			messages: []string{"docs [skip ci]", "feature"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			filters := config.Filters{SkipCI: tt.skipCI}
+			if got := filterReason(filters, &filterInput{event: "push", commitMessages: tt.messages}); got != tt.want {
+				t.Errorf("filterReason() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNewFilterInput(t *testing.T) {
+	github, _ := providers.NewGithubProvider("")
+	gitlab, _ := providers.NewGitlabProvider("")
+
+	tests := []struct {
+		name         string
+		provider     providers.Provider
+		event        string
+		payload      string
+		wantRefs     []string
+		wantFiles    []string
+		wantMessages []string
+	}{
+		{
+			name:     "GithubPush",
+			provider: github,
+			event:    "push",
+			payload: `{"ref":"refs/heads/main","commits":[
+				{"id":"1","message":"first","added":["services/payments/new.go"],"modified":["go.mod"]},
+				{"id":"2","message":"head","modified":["go.mod"],"removed":["services/billing/old.go"]}],
+				"head_commit":{"id":"2","message":"head"}}`,
+			wantRefs:     []string{"refs/heads/main"},
+			wantFiles:    []string{"services/payments/new.go", "go.mod", "services/billing/old.go"},
+			wantMessages: []string{"first", "head"},
+		},
+		{
+			name:         "GitlabPush",
+			provider:     gitlab,
+			event:        "Push Hook",
+			payload:      `{"ref":"refs/heads/main","commits":[{"message":"m","added":["a"],"modified":["b"],"removed":["c"]}]}`,
+			wantRefs:     []string{"refs/heads/main"},
+			wantFiles:    []string{"a", "b", "c"},
+			wantMessages: []string{"m"},
+		},
+		{
+			name:     "GithubPullRequest",
+			provider: github,
+			event:    "pull_request",
+			payload:  `{"pull_request":{"base":{"ref":"main"},"head":{"ref":"feature/x"}}}`,
+			wantRefs: []string{"refs/heads/main", "refs/heads/feature/x"},
+		},
+		{
+			name:     "GitlabTagPush",
+			provider: gitlab,
+			event:    "Tag Push Hook",
+			payload:  `{"ref":"refs/tags/v1.0"}`,
+			wantRefs: []string{"refs/tags/v1.0"},
+		},
+		{
+			name:     "GitlabMergeRequest",
+			provider: gitlab,
+			event:    "Merge Request Hook",
+			payload:  `{"object_attributes":{"source_branch":"feature/x","target_branch":"main"}}`,
+			wantRefs: []string{"refs/heads/main", "refs/heads/feature/x"},
+		},
+		{
+			name:     "GithubIssueComment",
+			provider: github,
+			event:    "issue_comment",
+			payload:  `{}`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			hook := &providers.Hook{
+				Payload: []byte(tt.payload),
+				Headers: map[string]string{
+					providers.XGitHubEvent: tt.event,
+					providers.XGitlabEvent: tt.event,
+				},
+			}
+			in := newFilterInput(tt.provider, hook)
+			if !reflect.DeepEqual(in.refs, tt.wantRefs) {
+				t.Errorf("refs = %v, want %v", in.refs, tt.wantRefs)
+			}
+			if !reflect.DeepEqual(in.files, tt.wantFiles) {
+				t.Errorf("files = %v, want %v", in.files, tt.wantFiles)
+			}
+			if !reflect.DeepEqual(in.commitMessages, tt.wantMessages) {
+				t.Errorf("commitMessages = %v, want %v", in.commitMessages, tt.wantMessages)
+			}
+		})
+	}
+}
+
+func TestProxy_proxyRequestFiltersEvents(t *testing.T) {
+	hits := map[string]int{}
+	newUpstream := func(name string) *httptest.Server {
+		return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			hits[name]++
+			w.WriteHeader(http.StatusOK)
+		}))
+	}
+	pushOnly := newUpstream("pushOnly")
+	defer pushOnly.Close()
+	everything := newUpstream("everything")
+	defer everything.Close()
+
+	p, err := NewProxy([]string{pushOnly.URL, everything.URL}, []string{}, providers.GitlabProviderKind, "", []string{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	p.ApplyConfig(&config.Config{
+		Filters: config.Filters{Events: config.EventFilter{Deny: []string{"Note Hook"}}},
+		Upstreams: []config.Upstream{
+			{URL: pushOnly.URL, Filters: config.Filters{Events: config.EventFilter{Allow: []string{"Push Hook"}}}},
+		},
+	})
+	router := p.newRouter()
+
+	tests := []struct {
+		event          string
+		wantBody       string
+		wantPushOnly   int
+		wantEverything int
+	}{
+		{event: "Push Hook", wantPushOnly: 1, wantEverything: 1},
+		{event: "Tag Push Hook", wantPushOnly: 1, wantEverything: 2},
+		{event: "Note Hook", wantBody: "Ignoring request, event 'Note Hook' is denied", wantPushOnly: 1, wantEverything: 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.event, func(t *testing.T) {
+			rr := httptest.NewRecorder()
+			router.ServeHTTP(rr, createGitlabRequest(http.MethodPost, "/post", "", tt.event, "{}"))
+			if rr.Code != http.StatusOK {
+				t.Errorf("got status %v, want %v", rr.Code, http.StatusOK)
+			}
+			if len(tt.wantBody) > 0 && !strings.Contains(rr.Body.String(), tt.wantBody) {
+				t.Errorf("got body %q, want it to contain %q", rr.Body.String(), tt.wantBody)
+			}
+			if hits["pushOnly"] != tt.wantPushOnly || hits["everything"] != tt.wantEverything {
+				t.Errorf("upstream hits = %v, want pushOnly %d and everything %d", hits, tt.wantPushOnly, tt.wantEverything)
+			}
+		})
+	}
+
+	// With every upstream filtered out the hook is still acknowledged
+	p.ApplyConfig(&config.Config{
+		Upstreams: []config.Upstream{
+			{URL: pushOnly.URL, Filters: config.Filters{Events: config.EventFilter{Allow: []string{"Push Hook"}}}},
+			{URL: everything.URL, Filters: config.Filters{Events: config.EventFilter{Deny: []string{"Issue Hook"}}}},
+		},
+	})
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, createGitlabRequest(http.MethodPost, "/post", "", "Issue Hook", "{}"))
+	if rr.Code != http.StatusOK || !strings.HasPrefix(rr.Body.String(), "Ignoring request for all upstreams") {
+		t.Errorf("got %v %q, want 200 ignoring the request for all upstreams", rr.Code, rr.Body.String())
+	}
+}
+
+func TestFilterInput_expressionEnvNormalized(t *testing.T) {
+	var filters config.Filters
+	err := yaml.UnmarshalStrict([]byte(`
+expression: normalized.kind == "pr" && normalized.pullRequest.baseRef == "refs/heads/main"
+`), &filters)
+	if err != nil {
+		t.Fatal(err)
+	}
+	gitlab, _ := providers.NewGitlabProvider("")
+	hook := &providers.Hook{
+		Payload: []byte(`{"object_attributes":{"source_branch":"feature/x","target_branch":"main"}}`),
+		Headers: map[string]string{providers.XGitlabEvent: string(providers.GitlabMergeRequestEvent)},
+	}
+	if got := filterReason(filters, newFilterInput(gitlab, hook)); got != "" {
+		t.Errorf("filterReason() = %q, want the merge request into main to pass", got)
+	}
+}
@@ -0,0 +1,188 @@
+package proxy
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/stakater/GitWebhookProxy/pkg/utils"
+	"gopkg.in/yaml.v2"
+)
+
+const (
+	groupPrefix                = "@"
+	defaultGroupReloadInterval = time.Second * 30
+)
+
+// groupStore keeps the group memberships of a local file in sync with the
+// file on disk
+type groupStore struct {
+	path string
+
+	mu      sync.RWMutex
+	groups  map[string][]string
+	modTime time.Time
+}
+
+func newGroupStore(path string) (*groupStore, error) {
+	s := &groupStore{path: path}
+	if err := s.reload(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// parseGroups reads a YAML or JSON map of group names to members, or for
+// other file extensions a CODEOWNERS-style file with one group per line:
+//
+//	# comment
+//	@platform-team alice bob @carol
+func parseGroups(path string, data []byte) (map[string][]string, error) {
+	groups := make(map[string][]string)
+
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml", ".json":
+		if err := yaml.UnmarshalStrict(data, &groups); err != nil {
+			return nil, err
+		}
+	default:
+		scanner := bufio.NewScanner(bytes.NewReader(data))
+		for line := 1; scanner.Scan(); line++ {
+			fields := strings.Fields(scanner.Text())
+			if len(fields) == 0 || strings.HasPrefix(fields[0], "#") {
+				continue
+			}
+			if !strings.HasPrefix(fields[0], groupPrefix) {
+				return nil, fmt.Errorf("line %d: group '%s' must start with '%s'", line, fields[0], groupPrefix)
+			}
+			group := fields[0]
+			groups[group] = append(groups[group], fields[1:]...)
+		}
+		if err := scanner.Err(); err != nil {
+			return nil, err
+		}
+	}
+
+	normalized := make(map[string][]string, len(groups))
+	for group, members := range groups {
+		group = strings.TrimPrefix(strings.TrimSpace(group), groupPrefix)
+		if len(group) == 0 {
+			return nil, fmt.Errorf("group names must not be empty")
+		}
+		for _, member := range members {
+			member = strings.TrimPrefix(strings.TrimSpace(member), groupPrefix)
+			if len(member) > 0 {
+				normalized[group] = append(normalized[group], member)
+			}
+		}
+	}
+	return normalized, nil
+}
+
+func (s *groupStore) reload() error {
+	info, err := os.Stat(s.path)
+	if err != nil {
+		return err
+	}
+	data, err := ioutil.ReadFile(s.path)
+	if err != nil {
+		return err
+	}
+	groups, err := parseGroups(s.path, data)
+	if err != nil {
+		return fmt.Errorf("invalid groups file '%s': %s", s.path, err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.groups = groups
+	s.modTime = info.ModTime()
+	return nil
+}
+
+func (s *groupStore) changed() bool {
+	info, err := os.Stat(s.path)
+	if err != nil {
+		// The file may be mid-update, try again on the next tick
+		return false
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return !info.ModTime().Equal(s.modTime)
+}
+
+// isMember reports whether user belongs to group, given without the @ prefix
+func (s *groupStore) isMember(group string, user string) bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	exists, _ := utils.InArray(s.groups[group], user)
+	return exists
+}
+
+// watch polls the file until stop is closed and reloads it when it changes.
+// A failed reload keeps the previous memberships.
+func (s *groupStore) watch(interval time.Duration, stop <-chan struct{}) {
+	if interval <= 0 {
+		interval = defaultGroupReloadInterval
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			if !s.changed() {
+				continue
+			}
+			if err := s.reload(); err != nil {
+				log.Printf("Error reloading groups, keeping the previous ones: %s", err)
+				continue
+			}
+			log.Printf("Reloaded groups from '%s'", s.path)
+		}
+	}
+}
+
+// LoadGroups reads the group memberships that @group entries of the user
+// lists refer to, and reloads them whenever the file changes
+func (p *Proxy) LoadGroups(path string, reloadInterval time.Duration) error {
+	store, err := newGroupStore(path)
+	if err != nil {
+		return err
+	}
+	p.groups = store
+	go store.watch(reloadInterval, p.stopped())
+	return nil
+}
+
+// SetAllowedUsers sets the users, or @groups, whose hooks are forwarded
+func (p *Proxy) SetAllowedUsers(allowedUsers []string) {
+	p.allowedUsers = allowedUsers
+}
+
+// inUserList reports whether the user is listed by login, or through the
+// membership of a listed @group
+func (p *Proxy) inUserList(list []string, user string) bool {
+	for _, entry := range list {
+		entry = strings.TrimSpace(entry)
+		if strings.HasPrefix(entry, groupPrefix) {
+			if p.groups != nil && p.groups.isMember(strings.TrimPrefix(entry, groupPrefix), user) {
+				return true
+			}
+			continue
+		}
+		if entry == user {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,115 @@
+package proxy
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestParseGroups(t *testing.T) {
+	want := map[string][]string{
+		"platform-team": {"alice", "bob"},
+		"bots":          {"renovate"},
+	}
+	tests := []struct {
+		name string
+		path string
+		data string
+	}{
+		{
+			name: "YAML",
+			path: "groups.yaml",
+			data: "'@platform-team': [alice, bob]\nbots:\n  - renovate\n",
+		},
+		{
+			name: "JSON",
+			path: "groups.json",
+			data: `{"platform-team": ["alice", "@bob"], "bots": ["renovate"]}`,
+		},
+		{
+			name: "Codeowners",
+			path: "GROUPS",
+			data: "# Platform\n@platform-team alice\n@platform-team @bob\n\n@bots renovate\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseGroups(tt.path, []byte(tt.data))
+			if err != nil {
+				t.Fatalf("parseGroups() error = %v", err)
+			}
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("parseGroups() = %v, want %v", got, want)
+			}
+		})
+	}
+}
+
+func TestParseGroupsInvalid(t *testing.T) {
+	tests := []struct {
+		name string
+		path string
+		data string
+	}{
+		{"YAMLList", "groups.yml", "- alice\n"},
+		{"EmptyGroup", "groups.yml", "'@': [alice]\n"},
+		{"CodeownersWithoutAt", "GROUPS", "platform-team alice\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := parseGroups(tt.path, []byte(tt.data)); err == nil {
+				t.Errorf("parseGroups() error = nil, want an error")
+			}
+		})
+	}
+}
+
+func TestProxy_userListsWithGroups(t *testing.T) {
+	dir, err := ioutil.TempDir("", "groups")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "groups.yaml")
+	if err := ioutil.WriteFile(path, []byte("platform-team: [alice]\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	p := &Proxy{
+		provider:     "gitlab",
+		ignoredUsers: []string{"@bots", "mallory"},
+		allowedUsers: []string{"@platform-team", " carol"},
+	}
+	if err := p.LoadGroups(path, time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	defer p.Shutdown(context.Background(), 0)
+
+	if !p.isAllowedUser("alice") || !p.isAllowedUser("carol") || p.isAllowedUser("bob") {
+		t.Errorf("isAllowedUser() should allow alice through @platform-team and carol by login only")
+	}
+	if !p.isIgnoredUser("mallory") || p.isIgnoredUser("alice") {
+		t.Errorf("isIgnoredUser() should ignore mallory only")
+	}
+
+	if err := ioutil.WriteFile(path, []byte("platform-team: [bob]\nbots: [renovate]\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	later := time.Now().Add(time.Minute)
+	if err := os.Chtimes(path, later, later); err != nil {
+		t.Fatal(err)
+	}
+	if !p.groups.changed() {
+		t.Fatalf("changed() = false after the file was rewritten")
+	}
+	if err := p.groups.reload(); err != nil {
+		t.Fatal(err)
+	}
+	if p.isAllowedUser("alice") || !p.isAllowedUser("bob") || !p.isIgnoredUser("renovate") {
+		t.Errorf("user lists did not pick up the reloaded groups")
+	}
+}
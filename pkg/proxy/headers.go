@@ -0,0 +1,77 @@
+package proxy
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/stakater/GitWebhookProxy/pkg/config"
+)
+
+// hopByHopHeaders only apply to the connection between the provider and the
+// proxy, so they are never forwarded. Host and Content-Length are set by the
+// client for the forwarded request.
+var hopByHopHeaders = []string{
+	"Connection",
+	"Keep-Alive",
+	"Proxy-Authenticate",
+	"Proxy-Authorization",
+	"Proxy-Connection",
+	"Te",
+	"Trailer",
+	"Transfer-Encoding",
+	"Upgrade",
+	"Host",
+	"Content-Length",
+}
+
+// stripHopByHopHeaders removes hopByHopHeaders and the headers named in the
+// Connection header
+func stripHopByHopHeaders(header http.Header) {
+	for _, connection := range header["Connection"] {
+		for _, name := range strings.Split(connection, ",") {
+			if name = strings.TrimSpace(name); len(name) > 0 {
+				header.Del(name)
+			}
+		}
+	}
+	for _, name := range hopByHopHeaders {
+		header.Del(name)
+	}
+}
+
+// applyHeaderRules drops the headers not allowed by the rules of an upstream
+// and adds its static headers
+func applyHeaderRules(header http.Header, rules config.HeaderRules) {
+	for name := range header {
+		if (len(rules.Allow) > 0 && !headerNameMatches(rules.Allow, name)) || headerNameMatches(rules.Deny, name) {
+			header.Del(name)
+		}
+	}
+	for name, value := range rules.Set {
+		header.Set(name, value)
+	}
+}
+
+// headerNameMatches reports whether name matches one of the names in list,
+// case-insensitively and with a trailing '*' matching any suffix
+func headerNameMatches(list []string, name string) bool {
+	name = strings.ToLower(name)
+	for _, item := range list {
+		item = strings.ToLower(item)
+		if strings.HasSuffix(item, "*") {
+			if strings.HasPrefix(name, strings.TrimSuffix(item, "*")) {
+				return true
+			}
+		} else if item == name {
+			return true
+		}
+	}
+	return false
+}
+
+// headerRules returns the header rules of the upstream
+func (u *upstream) headerRules() config.HeaderRules {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	return u.config.Headers
+}
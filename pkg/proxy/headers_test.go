@@ -0,0 +1,89 @@
+package proxy
+
+import (
+	"net/http"
+	"reflect"
+	"testing"
+
+	"github.com/stakater/GitWebhookProxy/pkg/config"
+	"github.com/stakater/GitWebhookProxy/pkg/providers"
+)
+
+func TestNewRedirectRequestStripsHopByHopHeaders(t *testing.T) {
+	hook := &providers.Hook{
+		Payload: []byte(`{}`),
+		Headers: map[string]string{
+			"Content-Type":      "application/json",
+			"Content-Length":    "2",
+			"Connection":        "keep-alive, X-Trace",
+			"X-Trace":           "1",
+			"Transfer-Encoding": "chunked",
+			"X-Gitlab-Event":    "Push Hook",
+		},
+		RequestMethod: http.MethodPost,
+	}
+	req, err := newRedirectRequest(hook, "http://upstream/hook")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := http.Header{
+		"Content-Type":   {"application/json"},
+		"X-Gitlab-Event": {"Push Hook"},
+	}
+	if !reflect.DeepEqual(req.Header, want) {
+		t.Errorf("Header = %v, want %v", req.Header, want)
+	}
+}
+
+func TestApplyHeaderRules(t *testing.T) {
+	incoming := func() http.Header {
+		return http.Header{
+			"Content-Type":        {"application/json"},
+			"X-Github-Event":      {"push"},
+			"X-Hub-Signature":     {"sha1=a"},
+			"X-Hub-Signature-256": {"sha256=b"},
+			"User-Agent":          {"GitHub-Hookshot/1"},
+		}
+	}
+	tests := []struct {
+		name  string
+		rules config.HeaderRules
+		want  http.Header
+	}{
+		{
+			name:  "NoRules",
+			rules: config.HeaderRules{},
+			want:  incoming(),
+		},
+		{
+			name:  "Deny",
+			rules: config.HeaderRules{Deny: []string{"x-hub-signature*", "User-Agent"}},
+			want: http.Header{
+				"Content-Type":   {"application/json"},
+				"X-Github-Event": {"push"},
+			},
+		},
+		{
+			name: "AllowWithDenyAndSet",
+			rules: config.HeaderRules{
+				Allow: []string{"Content-Type", "X-GitHub-*"},
+				Deny:  []string{"X-Github-Delivery"},
+				Set:   map[string]string{"x-environment": "prod", "Content-Type": "application/vnd+json"},
+			},
+			want: http.Header{
+				"Content-Type":   {"application/vnd+json"},
+				"X-Github-Event": {"push"},
+				"X-Environment":  {"prod"},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			header := incoming()
+			applyHeaderRules(header, tt.rules)
+			if !reflect.DeepEqual(header, tt.want) {
+				t.Errorf("applyHeaderRules() = %v, want %v", header, tt.want)
+			}
+		})
+	}
+}
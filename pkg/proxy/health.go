@@ -0,0 +1,214 @@
+package proxy
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/stakater/GitWebhookProxy/pkg/providers"
+)
+
+const (
+	defaultHealthCheckInterval = time.Second * 15
+	defaultHealthCheckTimeout  = time.Second * 5
+)
+
+// HealthCheckOptions configures the background probes against upstreams
+type HealthCheckOptions struct {
+	// Path is requested on the scheme and host of every upstream. It may also
+	// be an absolute URL. Probing is disabled when empty.
+	Path     string
+	Interval time.Duration
+	Timeout  time.Duration
+	// RequireUpstream fails readiness unless at least one upstream is healthy
+	RequireUpstream bool
+}
+
+type readinessReport struct {
+	Status    string            `json:"status"`
+	Checks    map[string]string `json:"checks"`
+	Upstreams []UpstreamStatus  `json:"upstreams"`
+}
+
+const (
+	checkOK          = "ok"
+	statusReady      = "ok"
+	statusNotReady   = "unavailable"
+	readyCheckConfig = "config"
+	readyCheckDrain  = "shutdown"
+	readyCheckUp     = "upstreams"
+)
+
+// StartHealthChecks probes every upstream once and then keeps probing in the
+// background until the proxy shuts down
+func (p *Proxy) StartHealthChecks(opts HealthCheckOptions) {
+	if opts.Interval <= 0 {
+		opts.Interval = defaultHealthCheckInterval
+	}
+	if opts.Timeout <= 0 {
+		opts.Timeout = defaultHealthCheckTimeout
+	}
+
+	p.upstreamsMu.Lock()
+	p.healthOptions = opts
+	p.upstreamsMu.Unlock()
+
+	if len(opts.Path) == 0 && !p.hasConfiguredHealthURLs() {
+		log.Printf("Upstream health checks disabled, no health path configured")
+		return
+	}
+
+	client := &http.Client{
+		Timeout:   opts.Timeout,
+		Transport: transport,
+	}
+	p.probeUpstreams(client)
+
+	stop := p.stopped()
+	go func() {
+		ticker := time.NewTicker(opts.Interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+				p.probeUpstreams(client)
+			}
+		}
+	}()
+}
+
+func (p *Proxy) hasConfiguredHealthURLs() bool {
+	p.upstreamsMu.Lock()
+	defer p.upstreamsMu.Unlock()
+	for _, upstreamConfig := range p.upstreamConfigs {
+		if len(upstreamConfig.HealthURL) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+func (p *Proxy) probeUpstreams(client *http.Client) {
+	p.upstreamsMu.Lock()
+	healthPath := p.healthOptions.Path
+	p.upstreamsMu.Unlock()
+
+	for _, u := range p.upstreamStates() {
+		healthURL := u.configuredHealthURL()
+		if len(healthURL) == 0 {
+			healthURL = upstreamHealthURL(u.url, healthPath)
+		}
+		u.mu.Lock()
+		u.healthURL = healthURL
+		u.mu.Unlock()
+		if len(healthURL) == 0 {
+			continue
+		}
+
+		err := probe(client, healthURL)
+		if err != nil {
+			log.Printf("Health check for upstream '%s' failed: %s", u.url, err)
+		}
+		u.recordProbe(err)
+	}
+}
+
+func probe(client *http.Client, healthURL string) error {
+	resp, err := client.Get(healthURL)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 400 {
+		return fmt.Errorf("health check returned status %s", resp.Status)
+	}
+	return nil
+}
+
+func (p *Proxy) readiness() readinessReport {
+	report := readinessReport{
+		Status:    statusReady,
+		Checks:    map[string]string{},
+		Upstreams: []UpstreamStatus{},
+	}
+	fail := func(check string, err error) {
+		report.Checks[check] = err.Error()
+		report.Status = statusNotReady
+	}
+
+	p.upstreamsMu.Lock()
+	upstreamCount := len(p.upstreamURLs)
+	p.upstreamsMu.Unlock()
+
+	report.Checks[readyCheckConfig] = checkOK
+	if upstreamCount == 0 {
+		fail(readyCheckConfig, errors.New("no upstreams configured"))
+	} else if _, err := providers.NewProvider(p.provider, p.secret); err != nil {
+		fail(readyCheckConfig, err)
+	}
+
+	report.Checks[readyCheckDrain] = checkOK
+	if p.isDraining() {
+		fail(readyCheckDrain, errors.New("shutting down"))
+	}
+
+	healthy := 0
+	for _, u := range p.upstreamStates() {
+		status := u.status()
+		if status.Health == upstreamHealthy {
+			healthy++
+		}
+		report.Upstreams = append(report.Upstreams, status)
+	}
+
+	p.upstreamsMu.Lock()
+	opts := p.healthOptions
+	p.upstreamsMu.Unlock()
+	if opts.RequireUpstream && (len(opts.Path) > 0 || p.hasConfiguredHealthURLs()) {
+		report.Checks[readyCheckUp] = checkOK
+		if healthy == 0 {
+			fail(readyCheckUp, errors.New("no healthy upstream"))
+		}
+	}
+
+	return report
+}
+
+func writeJSON(w http.ResponseWriter, statusCode int, v interface{}) {
+	w.Header().Set(providers.ContentTypeHeader, providers.DefaultContentTypeHeaderValue)
+	w.WriteHeader(statusCode)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.Printf("Error writing JSON response: %s", err)
+	}
+}
+
+// Liveness Endpoint, only reports that the process is serving requests
+func (p *Proxy) livez(w http.ResponseWriter, r *http.Request, params httprouter.Params) {
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte("ok"))
+}
+
+// Readiness Endpoint
+func (p *Proxy) readyz(w http.ResponseWriter, r *http.Request, params httprouter.Params) {
+	report := p.readiness()
+	statusCode := http.StatusOK
+	if report.Status != statusReady {
+		statusCode = http.StatusServiceUnavailable
+	}
+	writeJSON(w, statusCode, report)
+}
+
+// Upstreams Endpoint, lists the current state of every upstream
+func (p *Proxy) upstreamz(w http.ResponseWriter, r *http.Request, params httprouter.Params) {
+	statuses := []UpstreamStatus{}
+	for _, u := range p.upstreamStates() {
+		statuses = append(statuses, u.status())
+	}
+	writeJSON(w, http.StatusOK, statuses)
+}
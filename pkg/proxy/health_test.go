@@ -0,0 +1,128 @@
+package proxy
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stakater/GitWebhookProxy/pkg/providers"
+)
+
+func getReadiness(t *testing.T, p *Proxy) (int, readinessReport) {
+	req, _ := http.NewRequest(http.MethodGet, "/readyz", nil)
+	rr := httptest.NewRecorder()
+	p.newRouter().ServeHTTP(rr, req)
+
+	var report readinessReport
+	if err := json.Unmarshal(rr.Body.Bytes(), &report); err != nil {
+		t.Fatalf("readyz returned invalid JSON %q: %v", rr.Body.String(), err)
+	}
+	return rr.Code, report
+}
+
+func TestUpstreamHealthURL(t *testing.T) {
+	tests := []struct {
+		name        string
+		upstreamURL string
+		healthPath  string
+		want        string
+	}{
+		{"EmptyPath", "https://jenkins.example.com/github-webhook/", "", ""},
+		{"PathOnUpstreamHost", "https://jenkins.example.com/github-webhook/", "/login", "https://jenkins.example.com/login"},
+		{"PathWithoutSlash", "http://jenkins:8080/hook", "login", "http://jenkins:8080/login"},
+		{"AbsoluteURL", "http://jenkins:8080/hook", "http://jenkins:8081/health", "http://jenkins:8081/health"},
+		{"UpstreamWithoutHost", "jenkins", "/login", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := upstreamHealthURL(tt.upstreamURL, tt.healthPath); got != tt.want {
+				t.Errorf("upstreamHealthURL() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestProxy_livez(t *testing.T) {
+	p := &Proxy{}
+	req, _ := http.NewRequest(http.MethodGet, "/livez", nil)
+	rr := httptest.NewRecorder()
+	p.newRouter().ServeHTTP(rr, req)
+	if rr.Code != http.StatusOK {
+		t.Errorf("livez returned status %v, want %v", rr.Code, http.StatusOK)
+	}
+}
+
+func TestProxy_readyz(t *testing.T) {
+	healthy := true
+	up := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/login" {
+			t.Errorf("health check requested path %s, want /login", r.URL.Path)
+		}
+		if !healthy {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer up.Close()
+	down := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer down.Close()
+
+	p, err := NewProxy([]string{up.URL + "/github-webhook/", down.URL}, []string{}, providers.GithubProviderKind, "", []string{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	code, report := getReadiness(t, p)
+	if code != http.StatusOK {
+		t.Errorf("readyz before health checks returned %v, want %v: %+v", code, http.StatusOK, report)
+	}
+
+	p.StartHealthChecks(HealthCheckOptions{Path: "/login", Interval: time.Hour, RequireUpstream: true})
+	defer p.Shutdown(context.Background(), 0)
+
+	code, report = getReadiness(t, p)
+	if code != http.StatusOK {
+		t.Errorf("readyz with one healthy upstream returned %v, want %v: %+v", code, http.StatusOK, report)
+	}
+	if len(report.Upstreams) != 2 || report.Upstreams[0].Health != upstreamHealthy ||
+		report.Upstreams[1].Health != upstreamUnhealthy {
+		t.Errorf("readyz upstreams = %+v, want first healthy and second unhealthy", report.Upstreams)
+	}
+
+	healthy = false
+	p.probeUpstreams(http.DefaultClient)
+	code, report = getReadiness(t, p)
+	if code != http.StatusServiceUnavailable {
+		t.Errorf("readyz with no healthy upstream returned %v, want %v", code, http.StatusServiceUnavailable)
+	}
+	if report.Checks[readyCheckUp] == checkOK {
+		t.Errorf("readyz upstreams check = %v, want a failure", report.Checks[readyCheckUp])
+	}
+}
+
+func TestProxy_readyzWhileDraining(t *testing.T) {
+	p, err := NewProxy([]string{"http://127.0.0.1:0"}, []string{}, providers.GithubProviderKind, "", []string{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	p.Shutdown(context.Background(), 0)
+
+	code, report := getReadiness(t, p)
+	if code != http.StatusServiceUnavailable {
+		t.Errorf("readyz while draining returned %v, want %v", code, http.StatusServiceUnavailable)
+	}
+	if report.Checks[readyCheckDrain] == checkOK {
+		t.Errorf("readyz shutdown check = %v, want a failure", report.Checks[readyCheckDrain])
+	}
+}
+
+func TestProxy_readyzWithInvalidProvider(t *testing.T) {
+	p := &Proxy{provider: "invalid", upstreamURLs: []string{"http://127.0.0.1:0"}}
+	if code, _ := getReadiness(t, p); code != http.StatusServiceUnavailable {
+		t.Errorf("readyz with invalid provider returned %v, want %v", code, http.StatusServiceUnavailable)
+	}
+}
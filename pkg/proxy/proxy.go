@@ -10,12 +10,13 @@ import (
 	"net/http"
 	"net/url"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/julienschmidt/httprouter"
+	"github.com/stakater/GitWebhookProxy/pkg/config"
 	"github.com/stakater/GitWebhookProxy/pkg/parser"
 	"github.com/stakater/GitWebhookProxy/pkg/providers"
-	"github.com/stakater/GitWebhookProxy/pkg/utils"
 )
 
 var (
@@ -36,6 +37,45 @@ type Proxy struct {
 	secret       string
 	ignoredUsers []string
 	allowedUsers []string
+	botOptions   BotOptions
+	groups       *groupStore
+	// maxBodySize limits the size of hook bodies, 0 means no limit
+	maxBodySize int64
+
+	// drainMu guards draining, closed and additions to inFlight so that
+	// Shutdown never waits on a counter that is still growing. Readiness
+	// fails once draining, new deliveries are rejected once closed.
+	drainMu       sync.Mutex
+	draining      bool
+	closed        bool
+	inFlight      sync.WaitGroup
+	inFlightCount int
+	servers       []*http.Server
+	done          chan struct{}
+
+	upstreamsMu     sync.Mutex
+	upstreams       map[string]*upstream
+	healthOptions   HealthCheckOptions
+	breakerOptions  CircuitBreakerOptions
+	upstreamConfigs map[string]config.Upstream
+	filters         config.Filters
+	rateLimits      []config.RateLimitRule
+	limiter         *rateLimiter
+	coalesceRules   []config.CoalesceRule
+
+	pushesMu      sync.Mutex
+	pendingPushes map[string]*pendingPush
+
+	// config is the configuration file applied last, guarded by upstreamsMu
+	config *config.Config
+	// deliveries records recent deliveries, nil when disabled
+	deliveries *deliveryLog
+}
+
+// SetMaxBodySize sets the size in bytes above which hooks are rejected with
+// 413 Request Entity Too Large, 0 means no limit
+func (p *Proxy) SetMaxBodySize(maxBodySize int64) {
+	p.maxBodySize = maxBodySize
 }
 
 func (p *Proxy) isPathAllowed(path string) bool {
@@ -58,7 +98,7 @@ func (p *Proxy) isPathAllowed(path string) bool {
 
 func (p *Proxy) isIgnoredUser(committer string) bool {
 	if len(p.ignoredUsers) > 0 {
-		if exists, _ := utils.InArray(p.ignoredUsers, committer); exists {
+		if p.inUserList(p.ignoredUsers, committer) {
 			return true
 		}
 	}
@@ -72,7 +112,7 @@ func (p *Proxy) isIgnoredUser(committer string) bool {
 
 func (p *Proxy) isAllowedUser(committer string) bool {
 	if len(p.allowedUsers) > 0 {
-		if exists, _ := utils.InArray(p.allowedUsers, committer); exists {
+		if p.inUserList(p.allowedUsers, committer) {
 			return true
 		}
 
@@ -82,7 +122,26 @@ func (p *Proxy) isAllowedUser(committer string) bool {
 	return true
 }
 
-func (p *Proxy) redirect(hook *providers.Hook, redirectURL string) (*http.Response, error) {
+// deliver sends the hook to an upstream, in the format configured for it
+func (p *Proxy) deliver(u *upstream, in *filterInput, redirectURL string) (*http.Response, error) {
+	req, err := newRedirectRequest(in.hook, redirectURL)
+	if err != nil {
+		return nil, err
+	}
+	applyHeaderRules(req.Header, u.headerRules())
+	if err := transformRequest(req, u.transform(), in); err != nil {
+		return nil, err
+	}
+	if mode := u.cloudEventsMode(); len(mode) > 0 {
+		if err := toCloudEvent(req, mode, in.hook, in.normalized); err != nil {
+			return nil, err
+		}
+	}
+	return u.httpClient().Do(req)
+}
+
+// newRedirectRequest builds the request that forwards the hook as it was received
+func newRedirectRequest(hook *providers.Hook, redirectURL string) (*http.Request, error) {
 	if hook == nil {
 		return nil, errors.New("Cannot redirect with nil Hook")
 	}
@@ -98,8 +157,9 @@ func (p *Proxy) redirect(hook *providers.Hook, redirectURL string) (*http.Respon
 		url.Scheme = "http"
 	}
 
-	// Create Redirect request
-	req, err := http.NewRequest(hook.RequestMethod, url.String(), bytes.NewBuffer(hook.Payload))
+	// Create Redirect request. Each request reads hook.Payload through its own
+	// reader, so the body is shared by the concurrent requests to the upstreams.
+	req, err := http.NewRequest(hook.RequestMethod, url.String(), bytes.NewReader(hook.Payload))
 
 	if err != nil {
 		return nil, err
@@ -109,18 +169,36 @@ func (p *Proxy) redirect(hook *providers.Hook, redirectURL string) (*http.Respon
 	for key, value := range hook.Headers {
 		req.Header.Add(key, value)
 	}
+	stripHopByHopHeaders(req.Header)
 
-	return httpClient.Do(req)
-
+	return req, nil
 }
 
 func (p *Proxy) proxyRequest(w http.ResponseWriter, r *http.Request, params httprouter.Params) {
+	rec := p.recordDelivery(w, r)
+	if rec != nil {
+		w = rec
+	}
+	defer rec.finish()
+
+	if !p.beginDelivery() {
+		log.Printf("Rejecting request for '%s' while shutting down", r.URL.Path)
+		http.Error(w, "Proxy is shutting down", http.StatusServiceUnavailable)
+		return
+	}
+	defer p.endDelivery()
+
 	if !p.isPathAllowed(r.URL.Path) {
 		log.Printf("Not allowed to proxy path: '%s'", r.URL.Path)
 		http.Error(w, "Not allowed to proxy path: '"+r.URL.Path+"'", http.StatusForbidden)
 		return
 	}
 
+	rateLimit, rateLimitIndex := p.rateLimitRule(r.URL.Path)
+	if rateLimit != nil && !p.checkRateLimit(w, rateLimitIndex, "client IP", clientIP(r, rateLimit.TrustForwardedFor), rateLimit.IP) {
+		return
+	}
+
 	provider, err := providers.NewProvider(p.provider, p.secret)
 	if err != nil {
 		log.Printf("Error creating provider: %s", err)
@@ -128,17 +206,32 @@ func (p *Proxy) proxyRequest(w http.ResponseWriter, r *http.Request, params http
 		return
 	}
 
-	hook, err := parser.Parse(r, provider)
+	hook, err := parser.ParseLimited(r, provider, p.maxBodySize)
+	if err == parser.ErrBodyTooLarge {
+		log.Printf("Rejecting request for '%s', body exceeds %d bytes", r.URL.Path, p.maxBodySize)
+		http.Error(w, fmt.Sprintf("Request body exceeds the limit of %d bytes", p.maxBodySize), http.StatusRequestEntityTooLarge)
+		return
+	}
 	if err != nil {
 		log.Printf("Error Parsing Hook: %s", err)
 		http.Error(w, "Error parsing Hook: "+err.Error(), http.StatusBadRequest)
 		return
 	}
 
-	if len(p.ignoredUsers) > 0 || len(p.allowedUsers) > 0 {
+	filterIn := newFilterInput(provider, hook)
+	rec.setHook(filterIn)
+
+	if len(p.ignoredUsers) > 0 || len(p.allowedUsers) > 0 || p.botOptions.Ignore {
 		if event := provider.GetEventType(*hook); provider.IsCommitterCheckEvent(event) {
-			committer := provider.GetCommitter(*hook, event)
+			actor := provider.GetActor(*hook, event)
+			committer := actor.Login
 			log.Printf("Incoming request from user: %s", committer)
+			if p.isIgnoredBot(actor) {
+				log.Printf("Ignoring request for bot: %s", committer)
+				w.WriteHeader(http.StatusOK)
+				w.Write([]byte(fmt.Sprintf("Ignoring request for bot: %s", committer)))
+				return
+			}
 			if p.isIgnoredUser(committer) || (!p.isAllowedUser(committer)) {
 				log.Printf("Ignoring request for user: %s", committer)
 				w.WriteHeader(http.StatusOK)
@@ -154,19 +247,30 @@ func (p *Proxy) proxyRequest(w http.ResponseWriter, r *http.Request, params http
 		return
 	}
 
-	var responses []*http.Response
-	var errorsList []error // Renamed to avoid conflict with the 'errors' package
+	if reason := filterReason(p.globalFilters(), filterIn); len(reason) > 0 {
+		log.Printf("Ignoring request, %s", reason)
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte(fmt.Sprintf("Ignoring request, %s", reason)))
+		return
+	}
+	if rateLimit != nil && !p.checkRateLimit(w, rateLimitIndex, "repository", filterIn.normalized.Repository.FullName, rateLimit.Repository) {
+		return
+	}
+
+	if p.coalescePush(w, r.URL, filterIn, rateLimit, rateLimitIndex) {
+		rec.setDecision(DecisionCoalesced)
+		return
+	}
 
-	for _, upstream := range p.upstreamURLs {
-		redirectURL := upstream + r.URL.Path
-		if r.URL.RawQuery != "" {
-			redirectURL += "?" + r.URL.RawQuery // Corrected query string concatenation
-		}
+	result := p.fanOut(r.URL, filterIn, rateLimit, rateLimitIndex)
+	rec.setUpstreams(result)
+	responses, errorsList, upstreams := result.responses, result.errors, result.upstreams
+	filteredReasons, upstreamRetryAfter := result.filteredReasons, result.retryAfter
 
-		log.Printf("Proxying Request from '%s', to upstream '%s'\n", r.URL, redirectURL)
-		resp, errRedirect := p.redirect(hook, redirectURL)
-		responses = append(responses, resp)
-		errorsList = append(errorsList, errRedirect) // Use renamed variable
+	if len(upstreams) == 0 && len(filteredReasons) > 0 {
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte("Ignoring request for all upstreams, " + strings.Join(filteredReasons, "; ")))
+		return
 	}
 
 	var successfulResponse *http.Response
@@ -174,7 +278,7 @@ func (p *Proxy) proxyRequest(w http.ResponseWriter, r *http.Request, params http
 
 	for i, resp := range responses {
 		upstreamErr := errorsList[i]
-		currentUpstreamURL := p.upstreamURLs[i] // For logging
+		currentUpstreamURL := upstreams[i].url // For logging
 
 		if upstreamErr != nil {
 			log.Printf("Error redirecting to upstream '%s': %s\n", currentUpstreamURL, upstreamErr)
@@ -215,6 +319,10 @@ func (p *Proxy) proxyRequest(w http.ResponseWriter, r *http.Request, params http
 		}
 		w.WriteHeader(successfulResponse.StatusCode)
 		w.Write(responseBody)
+	} else if upstreamRetryAfter > 0 && onlyRateLimited(errorsList) {
+		log.Printf("All upstreams are over their rate limit\n")
+		setRetryAfter(w, upstreamRetryAfter)
+		http.Error(w, "Rate limit exceeded for every upstream", http.StatusTooManyRequests)
 	} else {
 		log.Printf("All upstream requests failed. Last error: %v\n", lastError)
 		http.Error(w, "All upstream requests failed", http.StatusInternalServerError)
@@ -223,22 +331,79 @@ func (p *Proxy) proxyRequest(w http.ResponseWriter, r *http.Request, params http
 
 // Health Check Endpoint
 func (p *Proxy) health(w http.ResponseWriter, r *http.Request, params httprouter.Params) {
+	if p.isDraining() {
+		http.Error(w, "Shutting down", http.StatusServiceUnavailable)
+		return
+	}
 	w.WriteHeader(200)
 	w.Write([]byte("I'm Healthy and I know it! ;) "))
 }
 
+func (p *Proxy) newRouter() *httprouter.Router {
+	router := httprouter.New()
+	router.GET("/health", p.health)
+	router.GET("/livez", p.livez)
+	router.GET("/readyz", p.readyz)
+	router.GET("/upstreamz", p.upstreamz)
+	router.POST("/*path", p.proxyRequest)
+	return router
+}
+
 // Run starts Proxy server
 func (p *Proxy) Run(listenAddress string) error {
 	if len(strings.TrimSpace(listenAddress)) == 0 {
 		panic("Cannot create Proxy with empty listenAddress")
 	}
 
-	router := httprouter.New()
-	router.GET("/health", p.health)
-	router.POST("/*path", p.proxyRequest)
+	server := &http.Server{
+		Addr:    listenAddress,
+		Handler: p.newRouter(),
+	}
+	if !p.trackServer(server) {
+		return nil
+	}
 
 	log.Printf("Listening at: %s", listenAddress)
-	return http.ListenAndServe(listenAddress, router)
+	return ignoreServerClosed(server.ListenAndServe())
+}
+
+// RunTLS starts Proxy server terminating TLS itself. Certificate, key and
+// client CA files are reloaded whenever they change on disk.
+func (p *Proxy) RunTLS(listenAddress string, tlsOptions TLSOptions) error {
+	if len(strings.TrimSpace(listenAddress)) == 0 {
+		panic("Cannot create Proxy with empty listenAddress")
+	}
+
+	server := &http.Server{
+		Addr:    listenAddress,
+		Handler: p.newRouter(),
+	}
+	return p.serveTLS(server, tlsOptions, "Listening")
+}
+
+// serveTLS serves server with TLS until it is shut down. Certificate, key
+// and client CA files are reloaded whenever they change on disk.
+func (p *Proxy) serveTLS(server *http.Server, tlsOptions TLSOptions, name string) error {
+	reloader, err := newCertReloader(tlsOptions.CertFile, tlsOptions.KeyFile, tlsOptions.ClientCAFile)
+	if err != nil {
+		return err
+	}
+	tlsConfig, err := newTLSConfig(tlsOptions, reloader)
+	if err != nil {
+		return err
+	}
+
+	stop := make(chan struct{})
+	defer close(stop)
+	go reloader.watch(tlsOptions.ReloadInterval, stop)
+
+	server.TLSConfig = tlsConfig
+	if !p.trackServer(server) {
+		return nil
+	}
+
+	log.Printf("%s with TLS at: %s", name, server.Addr)
+	return ignoreServerClosed(server.ListenAndServeTLS("", ""))
 }
 
 func NewProxy(initialUpstreamURLs []string, allowedPaths []string,
@@ -251,6 +416,11 @@ func NewProxy(initialUpstreamURLs []string, allowedPaths []string,
 		if len(strings.TrimSpace(u)) == 0 {
 			return nil, errors.New("Cannot create Proxy with an empty URL in upstreamURLs list")
 		}
+		if config.IsURLTemplate(u) {
+			if _, err := config.ParseURLTemplate(u); err != nil {
+				return nil, fmt.Errorf("Cannot create Proxy with an invalid URL template '%s' in upstreamURLs list: %s", u, err)
+			}
+		}
 	}
 	if len(strings.TrimSpace(provider)) == 0 {
 		return nil, errors.New("Cannot create Proxy with empty provider")
@@ -267,3 +437,91 @@ func NewProxy(initialUpstreamURLs []string, allowedPaths []string,
 		ignoredUsers: ignoredUsers,
 	}, nil
 }
+
+// fanOutResult holds the outcome of sending a hook to the upstreams: the
+// response or error and the latency of every attempted upstream, in the
+// same order. The latency of skipped upstreams is 0.
+type fanOutResult struct {
+	responses       []*http.Response
+	errors          []error
+	latencies       []time.Duration
+	upstreams       []*upstream
+	filteredReasons []string
+	// retryAfter is the longest wait for a token of a rate limited upstream
+	retryAfter time.Duration
+}
+
+// fanOut sends the hook to every upstream whose filters it passes. The
+// upstreams are called concurrently so that a slow upstream does not delay
+// the others.
+func (p *Proxy) fanOut(requestURL *url.URL, filterIn *filterInput, rateLimit *config.RateLimitRule, rateLimitIndex int) *fanOutResult {
+	result := &fanOutResult{}
+
+	for _, upstream := range p.upstreamStates() {
+		if reason := filterReason(upstream.filters(), filterIn); len(reason) > 0 {
+			log.Printf("Not proxying to upstream '%s', %s\n", upstream.url, reason)
+			result.filteredReasons = append(result.filteredReasons, fmt.Sprintf("%s: %s", upstream.url, reason))
+			continue
+		}
+		result.upstreams = append(result.upstreams, upstream)
+	}
+
+	result.responses = make([]*http.Response, len(result.upstreams))
+	result.errors = make([]error, len(result.upstreams))
+	result.latencies = make([]time.Duration, len(result.upstreams))
+	retryAfters := make([]time.Duration, len(result.upstreams))
+
+	var wg sync.WaitGroup
+	for i := range result.upstreams {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			result.responses[i], result.latencies[i], retryAfters[i], result.errors[i] =
+				p.sendToUpstream(result.upstreams[i], requestURL, filterIn, rateLimit, rateLimitIndex)
+		}(i)
+	}
+	wg.Wait()
+
+	for _, retryAfter := range retryAfters {
+		if retryAfter > result.retryAfter {
+			result.retryAfter = retryAfter
+		}
+	}
+	return result
+}
+
+// sendToUpstream sends the hook to an upstream unless it is paused, rate
+// limited or its circuit is open. retryAfter is the wait for a token when
+// the upstream is rate limited.
+func (p *Proxy) sendToUpstream(upstream *upstream, requestURL *url.URL, filterIn *filterInput,
+	rateLimit *config.RateLimitRule, rateLimitIndex int) (resp *http.Response, latency time.Duration, retryAfter time.Duration, err error) {
+	if upstream.isPaused() {
+		log.Printf("Skipping upstream '%s', it is paused\n", upstream.url)
+		return nil, 0, 0, errUpstreamPaused
+	}
+
+	redirectURL, err := upstream.redirectURL(requestURL, filterIn)
+	if err != nil {
+		return nil, 0, 0, fmt.Errorf("url template failed: %s", err)
+	}
+
+	if rateLimit != nil && rateLimit.Upstream.Enabled() {
+		key := fmt.Sprintf("%d/upstream/%s", rateLimitIndex, upstream.url)
+		if allowed, retryAfter := p.limiter.allow(key, rateLimit.Upstream, p.stopped()); !allowed {
+			log.Printf("Skipping upstream '%s', rate limit exceeded\n", upstream.url)
+			return nil, 0, retryAfter, errRateLimited
+		}
+	}
+
+	breaker := upstream.circuit()
+	if !breaker.allow() {
+		log.Printf("Skipping upstream '%s', circuit breaker is open\n", upstream.url)
+		return nil, 0, 0, errCircuitOpen
+	}
+
+	log.Printf("Proxying Request from '%s', to upstream '%s'\n", requestURL, redirectURL)
+	started := time.Now()
+	resp, err = p.deliver(upstream, filterIn, redirectURL)
+	breaker.record(err == nil && resp.StatusCode < 500)
+	return resp, time.Since(started), 0, err
+}
@@ -5,8 +5,12 @@ import (
 	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
 	"reflect"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 
 	httpmock "github.com/jarcoal/httpmock"
 	"github.com/julienschmidt/httprouter"
@@ -34,7 +38,7 @@ func getGitlabPayload() []byte {
 func TestProxy_isPathAllowed(t *testing.T) {
 	type fields struct {
 		provider     string
-		upstreamURL  string
+		upstreamURLs []string
 		allowedPaths []string
 		secret       string
 	}
@@ -51,7 +55,7 @@ func TestProxy_isPathAllowed(t *testing.T) {
 			name: "isPathAllowedWithValidMultipleAllowedPaths",
 			fields: fields{
 				provider:     providers.GithubProviderKind,
-				upstreamURL:  "https://dummyurl.com",
+				upstreamURLs: []string{"https://dummyurl.com"},
 				allowedPaths: []string{"/path1", "/path2"},
 				secret:       "secret",
 			},
@@ -64,7 +68,7 @@ func TestProxy_isPathAllowed(t *testing.T) {
 			name: "isPathAllowedWithValidOneAllowedPaths",
 			fields: fields{
 				provider:     providers.GithubProviderKind,
-				upstreamURL:  "https://dummyurl.com",
+				upstreamURLs: []string{"https://dummyurl.com"},
 				allowedPaths: []string{"/path1"},
 				secret:       "secret",
 			},
@@ -77,7 +81,7 @@ func TestProxy_isPathAllowed(t *testing.T) {
 			name: "isPathAllowedWithInvalidPath",
 			fields: fields{
 				provider:     providers.GithubProviderKind,
-				upstreamURL:  "https://dummyurl.com",
+				upstreamURLs: []string{"https://dummyurl.com"},
 				allowedPaths: []string{"/path1", "/path2"},
 				secret:       "secret",
 			},
@@ -90,7 +94,7 @@ func TestProxy_isPathAllowed(t *testing.T) {
 			name: "isPathAllowedWithEmtpyPathArg",
 			fields: fields{
 				provider:     providers.GithubProviderKind,
-				upstreamURL:  "https://dummyurl.com",
+				upstreamURLs: []string{"https://dummyurl.com"},
 				allowedPaths: []string{"/path1", "/path2"},
 				secret:       "secret",
 			},
@@ -103,7 +107,7 @@ func TestProxy_isPathAllowed(t *testing.T) {
 			name: "isPathAllowedWithAllPathsAllowedAndEmptyPathArg",
 			fields: fields{
 				provider:     providers.GithubProviderKind,
-				upstreamURL:  "https://dummyurl.com",
+				upstreamURLs: []string{"https://dummyurl.com"},
 				allowedPaths: []string{},
 				secret:       "secret",
 			},
@@ -116,7 +120,7 @@ func TestProxy_isPathAllowed(t *testing.T) {
 			name: "isPathAllowedWithAllPathsAllowedAndRootEmptyPathArg",
 			fields: fields{
 				provider:     providers.GithubProviderKind,
-				upstreamURL:  "https://dummyurl.com",
+				upstreamURLs: []string{"https://dummyurl.com"},
 				allowedPaths: []string{},
 				secret:       "secret",
 			},
@@ -129,7 +133,7 @@ func TestProxy_isPathAllowed(t *testing.T) {
 			name: "isPathAllowedWithAllPathsAllowedAndNonEmptyPathArg",
 			fields: fields{
 				provider:     providers.GithubProviderKind,
-				upstreamURL:  "https://dummyurl.com",
+				upstreamURLs: []string{"https://dummyurl.com"},
 				allowedPaths: []string{},
 				secret:       "secret",
 			},
@@ -142,7 +146,7 @@ func TestProxy_isPathAllowed(t *testing.T) {
 			name: "isPathAllowedWithSomePathsAllowedAndRootPathArg",
 			fields: fields{
 				provider:     providers.GithubProviderKind,
-				upstreamURL:  "https://dummyurl.com",
+				upstreamURLs: []string{"https://dummyurl.com"},
 				allowedPaths: []string{"/path1", "/path2"},
 				secret:       "secret",
 			},
@@ -155,7 +159,7 @@ func TestProxy_isPathAllowed(t *testing.T) {
 			name: "isPathAllowedWithSomePathsAllowedAndSubPathArg",
 			fields: fields{
 				provider:     providers.GithubProviderKind,
-				upstreamURL:  "https://dummyurl.com",
+				upstreamURLs: []string{"https://dummyurl.com"},
 				allowedPaths: []string{"/path1", "/path4"},
 				secret:       "secret",
 			},
@@ -168,7 +172,7 @@ func TestProxy_isPathAllowed(t *testing.T) {
 			name: "isPathAllowedWithSubPathsAllowedAndSubPathArg",
 			fields: fields{
 				provider:     providers.GithubProviderKind,
-				upstreamURL:  "https://dummyurl.com",
+				upstreamURLs: []string{"https://dummyurl.com"},
 				allowedPaths: []string{"/path1", "/path2/path3"},
 				secret:       "secret",
 			},
@@ -181,7 +185,7 @@ func TestProxy_isPathAllowed(t *testing.T) {
 			name: "isPathAllowedWithSubPathsAllowedAndPathArg",
 			fields: fields{
 				provider:     providers.GithubProviderKind,
-				upstreamURL:  "https://dummyurl.com",
+				upstreamURLs: []string{"https://dummyurl.com"},
 				allowedPaths: []string{"/path1", "/path2/path3"},
 				secret:       "secret",
 			},
@@ -194,7 +198,7 @@ func TestProxy_isPathAllowed(t *testing.T) {
 			name: "isPathAllowedWithAllowedPathTrailingSlashAndNotInArg",
 			fields: fields{
 				provider:     providers.GithubProviderKind,
-				upstreamURL:  "https://dummyurl.com",
+				upstreamURLs: []string{"https://dummyurl.com"},
 				allowedPaths: []string{"/path1", "/path2/"},
 				secret:       "secret",
 			},
@@ -207,7 +211,7 @@ func TestProxy_isPathAllowed(t *testing.T) {
 			name: "isPathAllowedWithSimpleAllowedPathAndTrailingSlashInArg",
 			fields: fields{
 				provider:     providers.GithubProviderKind,
-				upstreamURL:  "https://dummyurl.com",
+				upstreamURLs: []string{"https://dummyurl.com"},
 				allowedPaths: []string{"/path1", "/path2"},
 				secret:       "secret",
 			},
@@ -221,7 +225,7 @@ func TestProxy_isPathAllowed(t *testing.T) {
 		t.Run(tt.name, func(t *testing.T) {
 			p := &Proxy{
 				provider:     tt.fields.provider,
-				upstreamURL:  tt.fields.upstreamURL,
+				upstreamURLs: tt.fields.upstreamURLs,
 				allowedPaths: tt.fields.allowedPaths,
 				secret:       tt.fields.secret,
 			}
@@ -243,9 +247,9 @@ func createGitlabHook(tokenHeader string, tokenEvent string, body string, method
 	}
 }
 
-func TestProxy_redirect(t *testing.T) {
+func TestProxy_deliver(t *testing.T) {
 
-	httpmock.Activate()
+	httpmock.ActivateNonDefault(httpClient)
 	defer httpmock.DeactivateAndReset()
 
 	httpmock.RegisterResponder("GET", httpBinURLSecure,
@@ -262,7 +266,7 @@ func TestProxy_redirect(t *testing.T) {
 
 	type fields struct {
 		provider     string
-		upstreamURL  string
+		upstreamURLs []string
 		allowedPaths []string
 		secret       string
 	}
@@ -282,7 +286,7 @@ func TestProxy_redirect(t *testing.T) {
 			name: "TestRedirectWithValidValues",
 			fields: fields{
 				provider:     "gitlab",
-				upstreamURL:  httpBinURLSecure,
+				upstreamURLs: []string{httpBinURLSecure},
 				allowedPaths: []string{},
 				secret:       "dummy",
 			},
@@ -297,7 +301,7 @@ func TestProxy_redirect(t *testing.T) {
 			name: "TestRedirectWithGetUpstream",
 			fields: fields{
 				provider:     "gitlab",
-				upstreamURL:  httpBinURLSecure,
+				upstreamURLs: []string{httpBinURLSecure},
 				allowedPaths: []string{},
 				secret:       "dummy",
 			},
@@ -312,7 +316,7 @@ func TestProxy_redirect(t *testing.T) {
 			name: "TestRedirectWithEmptyPath",
 			fields: fields{
 				provider:     "github",
-				upstreamURL:  httpBinURLSecure + "/post",
+				upstreamURLs: []string{httpBinURLSecure + "/post"},
 				allowedPaths: []string{},
 				secret:       "dummy",
 			},
@@ -327,7 +331,7 @@ func TestProxy_redirect(t *testing.T) {
 			name: "TestRedirectWithEmptyPath",
 			fields: fields{
 				provider:     "github",
-				upstreamURL:  httpBinURLSecure + "/post",
+				upstreamURLs: []string{httpBinURLSecure + "/post"},
 				allowedPaths: []string{},
 				secret:       "dummy",
 			},
@@ -342,7 +346,7 @@ func TestProxy_redirect(t *testing.T) {
 			name: "TestRedirectWithNilHook",
 			fields: fields{
 				provider:     "github",
-				upstreamURL:  httpBinURLSecure,
+				upstreamURLs: []string{httpBinURLSecure},
 				allowedPaths: []string{},
 				secret:       "dummy",
 			},
@@ -356,7 +360,7 @@ func TestProxy_redirect(t *testing.T) {
 			name: "TestRedirectWithInvalidUrl",
 			fields: fields{
 				provider:     "gitlab",
-				upstreamURL:  "https://invalidurl",
+				upstreamURLs: []string{"https://invalidurl"},
 				allowedPaths: []string{},
 				secret:       "dummy",
 			},
@@ -370,7 +374,7 @@ func TestProxy_redirect(t *testing.T) {
 			name: "TestRedirectWithInvalidUrlScheme",
 			fields: fields{
 				provider:     "gitlab",
-				upstreamURL:  "htttpsss://" + httpBinURL,
+				upstreamURLs: []string{"htttpsss://" + httpBinURL},
 				allowedPaths: []string{},
 				secret:       "dummy",
 			},
@@ -384,7 +388,7 @@ func TestProxy_redirect(t *testing.T) {
 			name: "TestRedirectWithUrlWithoutScheme",
 			fields: fields{
 				provider:     "gitlab",
-				upstreamURL:  httpBinURL,
+				upstreamURLs: []string{httpBinURL},
 				allowedPaths: []string{},
 				secret:       "dummy",
 			},
@@ -400,11 +404,12 @@ func TestProxy_redirect(t *testing.T) {
 		t.Run(tt.name, func(t *testing.T) {
 			p := &Proxy{
 				provider:     tt.fields.provider,
-				upstreamURL:  tt.fields.upstreamURL,
+				upstreamURLs: tt.fields.upstreamURLs,
 				allowedPaths: tt.fields.allowedPaths,
 				secret:       tt.fields.secret,
 			}
-			gotResp, gotErrors := p.redirect(tt.args.hook, tt.args.redirectURL)
+			upstream := newUpstream(tt.fields.upstreamURLs[0])
+			gotResp, gotErrors := p.deliver(upstream, &filterInput{hook: tt.args.hook}, tt.args.redirectURL)
 
 			if (gotErrors != nil) != tt.wantErr {
 				t.Errorf("Parse() error = %v, wantErr %v", gotErrors, tt.wantErr)
@@ -416,13 +421,13 @@ func TestProxy_redirect(t *testing.T) {
 			}
 
 			if gotResp.StatusCode != tt.wantStatusCode {
-				t.Errorf("Proxy.redirect() got StatusCode in response= %v, want %v",
+				t.Errorf("Proxy.deliver() got StatusCode in response= %v, want %v",
 					gotResp.StatusCode, tt.wantStatusCode)
 				return
 			}
 
 			if gotResp.Request.Host != tt.wantRedirectedHost {
-				t.Errorf("Proxy.redirect() got Redirected Host in response= %v, want Redirected Host= %v",
+				t.Errorf("Proxy.deliver() got Redirected Host in response= %v, want Redirected Host= %v",
 					gotResp.Request.Host, tt.wantRedirectedHost)
 				return
 			}
@@ -463,9 +468,18 @@ func createRequestWithoutHeaders(method string, path string, body string) *http.
 }
 
 func TestProxy_proxyRequest(t *testing.T) {
+	httpmock.ActivateNonDefault(httpClient)
+	defer httpmock.DeactivateAndReset()
+
+	httpmock.RegisterResponder("POST", httpBinURLSecure+"/get",
+		httpmock.NewStringResponder(405, ``))
+
+	httpmock.RegisterResponder("POST", httpBinURLSecure+"/post",
+		httpmock.NewStringResponder(200, ``))
+
 	type fields struct {
 		provider     string
-		upstreamURL  string
+		upstreamURLs []string
 		allowedPaths []string
 		secret       string
 		allowedUsers []string
@@ -483,7 +497,7 @@ func TestProxy_proxyRequest(t *testing.T) {
 			name: "TestProxyRequestWithValidValues",
 			fields: fields{
 				provider:     providers.GitlabProviderKind,
-				upstreamURL:  httpBinURLSecure,
+				upstreamURLs: []string{httpBinURLSecure},
 				allowedPaths: []string{},
 				secret:       proxyGitlabTestSecret,
 			},
@@ -497,7 +511,7 @@ func TestProxy_proxyRequest(t *testing.T) {
 			name: "TestProxyRequestWithoutConfiguringSecret",
 			fields: fields{
 				provider:     providers.GitlabProviderKind,
-				upstreamURL:  httpBinURLSecure,
+				upstreamURLs: []string{httpBinURLSecure},
 				allowedPaths: []string{},
 				secret:       "",
 			},
@@ -511,7 +525,7 @@ func TestProxy_proxyRequest(t *testing.T) {
 			name: "TestProxyRequestWithoutSecretHearderInRequest",
 			fields: fields{
 				provider:     providers.GitlabProviderKind,
-				upstreamURL:  httpBinURLSecure,
+				upstreamURLs: []string{httpBinURLSecure},
 				allowedPaths: []string{},
 				secret:       proxyGitlabTestSecret,
 			},
@@ -525,7 +539,7 @@ func TestProxy_proxyRequest(t *testing.T) {
 			name: "TestProxyRequestWithInvalidSecretInHeader",
 			fields: fields{
 				provider:     providers.GitlabProviderKind,
-				upstreamURL:  httpBinURLSecure,
+				upstreamURLs: []string{httpBinURLSecure},
 				allowedPaths: []string{},
 				secret:       proxyGitlabTestSecret,
 			},
@@ -539,7 +553,7 @@ func TestProxy_proxyRequest(t *testing.T) {
 			name: "TestProxyRequestWithEmptySecretInHeader",
 			fields: fields{
 				provider:     providers.GitlabProviderKind,
-				upstreamURL:  httpBinURLSecure,
+				upstreamURLs: []string{httpBinURLSecure},
 				allowedPaths: []string{},
 				secret:       proxyGitlabTestSecret,
 			},
@@ -553,7 +567,7 @@ func TestProxy_proxyRequest(t *testing.T) {
 			name: "TestProxyRequestWithEmptyEventInHeader",
 			fields: fields{
 				provider:     providers.GitlabProviderKind,
-				upstreamURL:  httpBinURLSecure,
+				upstreamURLs: []string{httpBinURLSecure},
 				allowedPaths: []string{},
 				secret:       proxyGitlabTestSecret,
 			},
@@ -567,7 +581,7 @@ func TestProxy_proxyRequest(t *testing.T) {
 			name: "TestProxyRequestWithWrongHeaderKeys",
 			fields: fields{
 				provider:     providers.GitlabProviderKind,
-				upstreamURL:  httpBinURLSecure,
+				upstreamURLs: []string{httpBinURLSecure},
 				allowedPaths: []string{},
 				secret:       proxyGitlabTestSecret,
 			},
@@ -581,7 +595,7 @@ func TestProxy_proxyRequest(t *testing.T) {
 			name: "TestProxyRequestWithoutHeaderKeys",
 			fields: fields{
 				provider:     providers.GitlabProviderKind,
-				upstreamURL:  httpBinURLSecure,
+				upstreamURLs: []string{httpBinURLSecure},
 				allowedPaths: []string{},
 				secret:       proxyGitlabTestSecret,
 			},
@@ -594,7 +608,7 @@ func TestProxy_proxyRequest(t *testing.T) {
 			name: "TestProxyRequestWithUnsupportedUrlPath",
 			fields: fields{
 				provider:     providers.GitlabProviderKind,
-				upstreamURL:  httpBinURLSecure,
+				upstreamURLs: []string{httpBinURLSecure},
 				allowedPaths: []string{},
 				secret:       proxyGitlabTestSecret,
 			},
@@ -602,13 +616,14 @@ func TestProxy_proxyRequest(t *testing.T) {
 				request: createGitlabRequestWithPayload(http.MethodPost, "/get",
 					proxyGitlabTestSecret, proxyGitlabTestEvent, proxyGitlabTestPayload),
 			},
-			wantStatusCode: http.StatusMethodNotAllowed,
+			// Upstream errors are collapsed into a single failure once all upstreams are tried
+			wantStatusCode: http.StatusInternalServerError,
 		},
 		{
 			name: "TestProxyRequestShouldNotParseJsonWithoutAllowedOrIgnoredUsersConfigured",
 			fields: fields{
 				provider:     providers.GitlabProviderKind,
-				upstreamURL:  httpBinURLSecure,
+				upstreamURLs: []string{httpBinURLSecure},
 				allowedPaths: []string{},
 				secret:       "",
 			},
@@ -622,7 +637,7 @@ func TestProxy_proxyRequest(t *testing.T) {
 			name: "TestProxyRequestShouldParseJsonWithAllowedOrIgnoredUsersConfigured",
 			fields: fields{
 				provider:     providers.GitlabProviderKind,
-				upstreamURL:  httpBinURLSecure,
+				upstreamURLs: []string{httpBinURLSecure},
 				allowedPaths: []string{},
 				secret:       "",
 				allowedUsers: []string{"jsmith"},
@@ -637,7 +652,7 @@ func TestProxy_proxyRequest(t *testing.T) {
 			name: "TestProxyRequestWithInvalidHttpMethod",
 			fields: fields{
 				provider:     providers.GitlabProviderKind,
-				upstreamURL:  httpBinURLSecure,
+				upstreamURLs: []string{httpBinURLSecure},
 				allowedPaths: []string{},
 				secret:       proxyGitlabTestSecret,
 			},
@@ -651,7 +666,7 @@ func TestProxy_proxyRequest(t *testing.T) {
 			name: "TestProxyRequestWithEmptyBody",
 			fields: fields{
 				provider:     providers.GitlabProviderKind,
-				upstreamURL:  httpBinURLSecure,
+				upstreamURLs: []string{httpBinURLSecure},
 				allowedPaths: []string{},
 				secret:       proxyGitlabTestSecret,
 			},
@@ -665,7 +680,7 @@ func TestProxy_proxyRequest(t *testing.T) {
 			name: "TestProxyRequestWithNotAllowedPath",
 			fields: fields{
 				provider:     providers.GitlabProviderKind,
-				upstreamURL:  httpBinURLSecure,
+				upstreamURLs: []string{httpBinURLSecure},
 				allowedPaths: []string{"/path1"},
 				secret:       proxyGitlabTestSecret,
 			},
@@ -679,7 +694,7 @@ func TestProxy_proxyRequest(t *testing.T) {
 			name: "TestProxyRequestWithAllowedPath",
 			fields: fields{
 				provider:     providers.GitlabProviderKind,
-				upstreamURL:  httpBinURLSecure,
+				upstreamURLs: []string{httpBinURLSecure},
 				allowedPaths: []string{"/post"},
 				secret:       proxyGitlabTestSecret,
 			},
@@ -693,7 +708,7 @@ func TestProxy_proxyRequest(t *testing.T) {
 			name: "TestProxyRequestWithInvalidUpstreamUrl",
 			fields: fields{
 				provider:     providers.GitlabProviderKind,
-				upstreamURL:  "invalidurl",
+				upstreamURLs: []string{"invalidurl"},
 				allowedPaths: []string{},
 				secret:       proxyGitlabTestSecret,
 			},
@@ -707,7 +722,7 @@ func TestProxy_proxyRequest(t *testing.T) {
 			name: "TestProxyRequestWithInvalidProvider",
 			fields: fields{
 				provider:     "invalid",
-				upstreamURL:  httpBinURLSecure,
+				upstreamURLs: []string{httpBinURLSecure},
 				allowedPaths: []string{},
 				secret:       proxyGitlabTestSecret,
 			},
@@ -721,7 +736,7 @@ func TestProxy_proxyRequest(t *testing.T) {
 			name: "TestProxyRequestWithWrongProviderKind",
 			fields: fields{
 				provider:     providers.GithubProviderKind,
-				upstreamURL:  httpBinURLSecure,
+				upstreamURLs: []string{httpBinURLSecure},
 				allowedPaths: []string{},
 				secret:       proxyGitlabTestSecret,
 			},
@@ -735,7 +750,7 @@ func TestProxy_proxyRequest(t *testing.T) {
 			name: "TestProxyRequestWithInvalidSecretInProvider",
 			fields: fields{
 				provider:     providers.GitlabProviderKind,
-				upstreamURL:  httpBinURLSecure,
+				upstreamURLs: []string{httpBinURLSecure},
 				allowedPaths: []string{},
 				secret:       "wrong",
 			},
@@ -749,7 +764,7 @@ func TestProxy_proxyRequest(t *testing.T) {
 			name: "TestProxyRequestWithEmptySecretInProvider",
 			fields: fields{
 				provider:     providers.GitlabProviderKind,
-				upstreamURL:  httpBinURLSecure,
+				upstreamURLs: []string{httpBinURLSecure},
 				allowedPaths: []string{},
 				secret:       "",
 			},
@@ -764,7 +779,7 @@ func TestProxy_proxyRequest(t *testing.T) {
 		t.Run(tt.name, func(t *testing.T) {
 			p := &Proxy{
 				provider:     tt.fields.provider,
-				upstreamURL:  tt.fields.upstreamURL,
+				upstreamURLs: tt.fields.upstreamURLs,
 				allowedPaths: tt.fields.allowedPaths,
 				secret:       tt.fields.secret,
 				allowedUsers: tt.fields.allowedUsers,
@@ -787,7 +802,7 @@ func TestProxy_proxyRequest(t *testing.T) {
 func TestProxy_health(t *testing.T) {
 	type fields struct {
 		provider     string
-		upstreamURL  string
+		upstreamURLs []string
 		allowedPaths []string
 		secret       string
 	}
@@ -819,7 +834,7 @@ func TestProxy_health(t *testing.T) {
 		t.Run(tt.name, func(t *testing.T) {
 			p := &Proxy{
 				provider:     tt.fields.provider,
-				upstreamURL:  tt.fields.upstreamURL,
+				upstreamURLs: tt.fields.upstreamURLs,
 				allowedPaths: tt.fields.allowedPaths,
 				secret:       tt.fields.secret,
 			}
@@ -845,7 +860,7 @@ func TestProxy_health(t *testing.T) {
 func TestProxy_Run(t *testing.T) {
 	type fields struct {
 		provider     string
-		upstreamURL  string
+		upstreamURLs []string
 		allowedPaths []string
 		secret       string
 	}
@@ -865,7 +880,7 @@ func TestProxy_Run(t *testing.T) {
 		t.Run(tt.name, func(t *testing.T) {
 			p := &Proxy{
 				provider:     tt.fields.provider,
-				upstreamURL:  tt.fields.upstreamURL,
+				upstreamURLs: tt.fields.upstreamURLs,
 				allowedPaths: tt.fields.allowedPaths,
 				secret:       tt.fields.secret,
 			}
@@ -976,6 +991,16 @@ func TestNewProxy(t *testing.T) {
 			},
 			wantErr: false,
 		},
+		{
+			name: "TestNewProxyWithInvalidUpstreamURLTemplate",
+			args: args{
+				upstreamURLs: []string{httpBinURLSecure + "/job/{{.repository.name"},
+				allowedPaths: []string{},
+				provider:     providers.GitlabProviderKind,
+				secret:       proxyGitlabTestSecret,
+			},
+			wantErr: true,
+		},
 		{
 			name: "TestNewProxyWithNilAllowedPaths",
 			args: args{
@@ -1053,7 +1078,7 @@ func TestNewProxy(t *testing.T) {
 				} else if tt.name == "TestNewProxyWithUpstreamURLsSliceContainingEmptyString" || tt.name == "TestNewProxyWithUpstreamURLsSliceContainingValidAndEmptyString" {
 					expectedErrorMsg = "Cannot create Proxy with an empty URL in upstreamURLs list"
 				}
-				if err != nil && err.Error() != expectedErrorMsg {
+				if expectedErrorMsg != "" && err != nil && err.Error() != expectedErrorMsg {
 					t.Errorf("NewProxy() error = %v, wantErrMsg %v", err.Error(), expectedErrorMsg)
 				}
 				return // Do not proceed to DeepEqual check if an error is expected
@@ -1072,6 +1097,8 @@ func TestProxy_proxyRequest_MultiUpstream(t *testing.T) {
 		req := httptest.NewRequest(method, path, bytes.NewReader([]byte(body)))
 		// Add common headers if necessary, e.g., for provider validation if secret is used
 		req.Header.Add(providers.ContentTypeHeader, providers.DefaultContentTypeHeaderValue)
+		req.Header.Add(providers.XGitHubDelivery, "test-delivery")
+		req.Header.Add(providers.XGitHubEvent, "ping")
 		return req
 	}
 
@@ -1096,10 +1123,10 @@ func TestProxy_proxyRequest_MultiUpstream(t *testing.T) {
 
 		p, err := NewProxy(
 			[]string{server1.URL, server2.URL},
-			[]string{}, // Allow all paths
+			[]string{},                   // Allow all paths
 			providers.GithubProviderKind, // Using github for simplicity, no complex validation
-			"", // No secret
-			[]string{}, // No ignored users
+			"",                           // No secret
+			[]string{},                   // No ignored users
 		)
 		if err != nil {
 			t.Fatalf("Failed to create proxy: %v", err)
@@ -1276,7 +1303,7 @@ func TestProxy_proxyRequest_MultiUpstream(t *testing.T) {
 		if status := rr.Code; status != http.StatusOK {
 			t.Errorf("handler returned wrong status code: got %v want %v", status, http.StatusOK)
 		}
-		
+
 		// Response should be from server1
 		expectedBody := "server1 success"
 		if rr.Body.String() != expectedBody {
@@ -1290,7 +1317,7 @@ func TestProxy_proxyRequest_MultiUpstream(t *testing.T) {
 			t.Errorf("server2 expected 1 hit, got %d", hitCounter2)
 		}
 	})
-	
+
 	// Specific Response Content and Headers is implicitly tested by BasicFanOut and FirstUpstreamFails_SecondSucceeds
 	// as they check for specific body and headers from the successful server.
 
@@ -1318,7 +1345,7 @@ func TestProxy_isIgnoredUser(t *testing.T) {
 			name: "TestIsIgnoredUserWithEmptyList",
 			fields: fields{
 				provider:     providers.GithubProviderKind,
-				upstreamURL:  "https://dummyurl.com",
+				upstreamURLs: []string{"https://dummyurl.com"},
 				allowedPaths: []string{"/path1", "/path2"},
 				secret:       "secret",
 				ignoredUsers: []string{},
@@ -1332,7 +1359,7 @@ func TestProxy_isIgnoredUser(t *testing.T) {
 			name: "TestIsIgnoredUserWithValidList",
 			fields: fields{
 				provider:     providers.GithubProviderKind,
-				upstreamURL:  "https://dummyurl.com",
+				upstreamURLs: []string{"https://dummyurl.com"},
 				allowedPaths: []string{"/path1", "/path2"},
 				secret:       "secret",
 				ignoredUsers: []string{"user1", "user2"},
@@ -1380,7 +1407,7 @@ func TestProxy_isAllowedUser(t *testing.T) {
 			name: "TestIsAllowedUserWithEmptyList",
 			fields: fields{
 				provider:     providers.GithubProviderKind,
-				upstreamURL:  "https://dummyurl.com",
+				upstreamURLs: []string{"https://dummyurl.com"},
 				allowedPaths: []string{"/path1", "/path2"},
 				secret:       "secret",
 				allowedUsers: []string{},
@@ -1394,7 +1421,7 @@ func TestProxy_isAllowedUser(t *testing.T) {
 			name: "TestIsAllowedUserWithValidList",
 			fields: fields{
 				provider:     providers.GithubProviderKind,
-				upstreamURL:  "https://dummyurl.com",
+				upstreamURLs: []string{"https://dummyurl.com"},
 				allowedPaths: []string{"/path1", "/path2"},
 				secret:       "secret",
 				allowedUsers: []string{"user1", "user2"},
@@ -1408,7 +1435,7 @@ func TestProxy_isAllowedUser(t *testing.T) {
 			name: "TestIsNotAllowedUserWithValidList",
 			fields: fields{
 				provider:     providers.GithubProviderKind,
-				upstreamURL:  "https://dummyurl.com",
+				upstreamURLs: []string{"https://dummyurl.com"},
 				allowedPaths: []string{"/path1", "/path2"},
 				secret:       "secret",
 				allowedUsers: []string{"user1", "user2"},
@@ -1434,3 +1461,123 @@ func TestProxy_isAllowedUser(t *testing.T) {
 		})
 	}
 }
+
+func TestProxy_proxyRequestFormEncodedGithubHook(t *testing.T) {
+	const secret = "formSecret"
+	var received []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		received = append(received, r.Header.Get(providers.ContentTypeHeader)+" "+string(body))
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	p, err := NewProxy([]string{server.URL}, []string{}, providers.GithubProviderKind, secret, []string{"mallory"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	router := p.newRouter()
+
+	createFormRequest := func(sender string) (*http.Request, string) {
+		body := url.Values{providers.FormPayloadField: {`{"ref":"refs/heads/main","sender":{"login":"` + sender + `"}}`}}.Encode()
+		req := httptest.NewRequest(http.MethodPost, "/github-webhook/", bytes.NewReader([]byte(body)))
+		req.Header.Add(providers.ContentTypeHeader, providers.FormContentTypeHeaderValue)
+		req.Header.Add(providers.XGitHubDelivery, "form-delivery")
+		req.Header.Add(providers.XGitHubEvent, string(providers.GithubPushEvent))
+		req.Header.Add(providers.XHubSignature, providers.SignaturePrefix+providers.HashPayload(secret, []byte(body)))
+		return req, body
+	}
+
+	req, body := createFormRequest("octocat")
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	if rr.Code != http.StatusOK || len(received) != 1 {
+		t.Fatalf("got %v %q with %d upstream hits, want the hook forwarded", rr.Code, rr.Body.String(), len(received))
+	}
+	if want := providers.FormContentTypeHeaderValue + " " + body; received[0] != want {
+		t.Errorf("upstream received %q, want the raw form body %q", received[0], want)
+	}
+
+	req, _ = createFormRequest("mallory")
+	rr = httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	if rr.Code != http.StatusOK || !strings.Contains(rr.Body.String(), "Ignoring request for user: mallory") || len(received) != 1 {
+		t.Errorf("got %v %q, want the ignored user's hook dropped", rr.Code, rr.Body.String())
+	}
+}
+
+func TestProxy_proxyRequestMaxBodySize(t *testing.T) {
+	var mu sync.Mutex
+	var bodies []string
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		mu.Lock()
+		bodies = append(bodies, string(body))
+		mu.Unlock()
+		w.WriteHeader(http.StatusOK)
+	})
+	server1 := httptest.NewServer(handler)
+	defer server1.Close()
+	server2 := httptest.NewServer(handler)
+	defer server2.Close()
+
+	p, err := NewProxy([]string{server1.URL, server2.URL}, []string{}, providers.GitlabProviderKind, "", []string{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	p.SetMaxBodySize(int64(len(proxyGitlabTestPayload)))
+	router := p.newRouter()
+
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, createGitlabRequestWithPayload(http.MethodPost, "/post", "", proxyGitlabTestEvent, []byte(string(proxyGitlabTestPayload)+" ")))
+	if rr.Code != http.StatusRequestEntityTooLarge || len(bodies) != 0 {
+		t.Errorf("got %v with %d upstream hits, want 413 without forwarding", rr.Code, len(bodies))
+	}
+
+	rr = httptest.NewRecorder()
+	router.ServeHTTP(rr, createGitlabRequestWithPayload(http.MethodPost, "/post", "", proxyGitlabTestEvent, proxyGitlabTestPayload))
+	if rr.Code != http.StatusOK || len(bodies) != 2 {
+		t.Fatalf("got %v with %d upstream hits, want the hook forwarded to both upstreams", rr.Code, len(bodies))
+	}
+	for i, body := range bodies {
+		if body != string(proxyGitlabTestPayload) {
+			t.Errorf("upstream %d received %d bytes, want the whole payload of %d bytes", i+1, len(body), len(proxyGitlabTestPayload))
+		}
+	}
+}
+
+func TestProxy_proxyRequestConcurrentUpstreams(t *testing.T) {
+	fastReceived := make(chan string, 1)
+	slowSawFast := make(chan bool, 1)
+	// The slow upstream only answers once the fast one got the hook, or
+	// gives up after a while when the upstreams are called one by one
+	slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-fastReceived:
+			slowSawFast <- true
+		case <-time.After(2 * time.Second):
+			slowSawFast <- false
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer slow.Close()
+	fast := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		fastReceived <- string(body)
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer fast.Close()
+
+	p, err := NewProxy([]string{slow.URL, fast.URL}, []string{}, providers.GitlabProviderKind, "", []string{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	rr := httptest.NewRecorder()
+	p.newRouter().ServeHTTP(rr, createGitlabRequestWithPayload(http.MethodPost, "/post", "", proxyGitlabTestEvent, proxyGitlabTestPayload))
+	if rr.Code != http.StatusOK {
+		t.Errorf("got %v, want %v", rr.Code, http.StatusOK)
+	}
+	if !<-slowSawFast {
+		t.Errorf("the fast upstream got the hook only after the slow upstream answered")
+	}
+}
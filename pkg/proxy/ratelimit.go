@@ -0,0 +1,205 @@
+package proxy
+
+import (
+	"container/list"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/stakater/GitWebhookProxy/pkg/config"
+)
+
+// maxRateLimitBuckets bounds the buckets kept for client IPs and
+// repositories; the least recently used bucket is dropped beyond it
+const maxRateLimitBuckets = 10000
+
+var errRateLimited = errors.New("rate limit exceeded")
+
+// tokenBucket holds up to burst tokens and is refilled with rate tokens a second
+type tokenBucket struct {
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+func newTokenBucket(limit config.RateLimit, now time.Time) *tokenBucket {
+	burst := float64(limit.Burst)
+	if burst == 0 {
+		burst = math.Max(1, math.Floor(limit.PerMinute))
+	}
+	return &tokenBucket{
+		rate:   limit.PerMinute / 60,
+		burst:  burst,
+		tokens: burst,
+		last:   now,
+	}
+}
+
+func (b *tokenBucket) refill(now time.Time) {
+	if elapsed := now.Sub(b.last).Seconds(); elapsed > 0 {
+		b.tokens = math.Min(b.burst, b.tokens+elapsed*b.rate)
+		b.last = now
+	}
+}
+
+// take removes a token, or returns how long until one is available
+func (b *tokenBucket) take(now time.Time) time.Duration {
+	b.refill(now)
+	if b.tokens >= 1 {
+		b.tokens--
+		return 0
+	}
+	return time.Duration(math.Ceil((1 - b.tokens) / b.rate * float64(time.Second)))
+}
+
+// rateLimiter keeps a token bucket per key, e.g. per client IP, for up to
+// maxBuckets keys
+type rateLimiter struct {
+	now        func() time.Time
+	maxBuckets int
+
+	mu      sync.Mutex
+	buckets map[string]*list.Element
+	// lru holds the keyedBuckets, the most recently used first
+	lru *list.List
+}
+
+type keyedBucket struct {
+	key    string
+	bucket *tokenBucket
+}
+
+func newRateLimiter() *rateLimiter {
+	return &rateLimiter{
+		now:        time.Now,
+		maxBuckets: maxRateLimitBuckets,
+		buckets:    make(map[string]*list.Element),
+		lru:        list.New(),
+	}
+}
+
+func (l *rateLimiter) take(key string, limit config.RateLimit) time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	if element, ok := l.buckets[key]; ok {
+		l.lru.MoveToFront(element)
+		return element.Value.(*keyedBucket).bucket.take(now)
+	}
+	for len(l.buckets) >= l.maxBuckets && l.lru.Len() > 0 {
+		oldest := l.lru.Remove(l.lru.Back()).(*keyedBucket)
+		delete(l.buckets, oldest.key)
+	}
+	bucket := newTokenBucket(limit, now)
+	l.buckets[key] = l.lru.PushFront(&keyedBucket{key: key, bucket: bucket})
+	return bucket.take(now)
+}
+
+// reset drops every bucket
+func (l *rateLimiter) reset() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.buckets = make(map[string]*list.Element)
+	l.lru.Init()
+}
+
+// size returns the number of buckets kept
+func (l *rateLimiter) size() int {
+	if l == nil {
+		return 0
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return len(l.buckets)
+}
+
+// allow takes a token for key, waiting up to limit.Wait for one. When it
+// fails it returns how long until a token is available.
+func (l *rateLimiter) allow(key string, limit config.RateLimit, stop <-chan struct{}) (bool, time.Duration) {
+	deadline := l.now().Add(time.Duration(limit.Wait))
+	for {
+		wait := l.take(key, limit)
+		if wait == 0 {
+			return true, 0
+		}
+		if l.now().Add(wait).After(deadline) {
+			return false, wait
+		}
+		select {
+		case <-time.After(wait):
+		case <-stop:
+			return false, wait
+		}
+	}
+}
+
+// rateLimitRule returns the first rate limit rule matching the path and its
+// index, or nil when no rule applies
+func (p *Proxy) rateLimitRule(path string) (*config.RateLimitRule, int) {
+	p.upstreamsMu.Lock()
+	defer p.upstreamsMu.Unlock()
+	for i := range p.rateLimits {
+		rule := &p.rateLimits[i]
+		if len(rule.Paths) == 0 || rule.Paths.Match(path) {
+			return rule, i
+		}
+	}
+	return nil, -1
+}
+
+// checkRateLimit takes a token from the bucket of value for the limit. When
+// the limit is exceeded it responds with 429 and returns false.
+func (p *Proxy) checkRateLimit(w http.ResponseWriter, rule int, kind string, value string, limit config.RateLimit) bool {
+	if !limit.Enabled() || len(value) == 0 {
+		return true
+	}
+	allowed, retryAfter := p.limiter.allow(fmt.Sprintf("%d/%s/%s", rule, kind, value), limit, p.stopped())
+	if allowed {
+		return true
+	}
+	log.Printf("Rejecting request, rate limit exceeded for %s '%s'", kind, value)
+	setRetryAfter(w, retryAfter)
+	http.Error(w, fmt.Sprintf("Rate limit exceeded for %s '%s'", kind, value), http.StatusTooManyRequests)
+	return false
+}
+
+// onlyRateLimited is true when every upstream was skipped for its rate limit
+func onlyRateLimited(errs []error) bool {
+	for _, err := range errs {
+		if err != errRateLimited {
+			return false
+		}
+	}
+	return len(errs) > 0
+}
+
+func setRetryAfter(w http.ResponseWriter, retryAfter time.Duration) {
+	w.Header().Set("Retry-After", fmt.Sprintf("%d", int(math.Ceil(retryAfter.Seconds()))))
+}
+
+// clientIP returns the IP of the client, or the last address of
+// X-Forwarded-For when it is trusted. The client can send any addresses
+// itself, only the last one was added by the trusted load balancer.
+func clientIP(r *http.Request, trustForwardedFor bool) string {
+	if trustForwardedFor {
+		if forwarded := r.Header["X-Forwarded-For"]; len(forwarded) > 0 {
+			addresses := strings.Split(forwarded[len(forwarded)-1], ",")
+			if last := strings.TrimSpace(addresses[len(addresses)-1]); len(last) > 0 {
+				return last
+			}
+		}
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
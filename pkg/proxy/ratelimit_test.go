@@ -0,0 +1,202 @@
+package proxy
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stakater/GitWebhookProxy/pkg/config"
+	"github.com/stakater/GitWebhookProxy/pkg/providers"
+)
+
+func TestRateLimiter_allow(t *testing.T) {
+	now := time.Unix(0, 0)
+	limiter := newRateLimiter()
+	limiter.now = func() time.Time { return now }
+	limit := config.RateLimit{PerMinute: 60, Burst: 2}
+
+	for i := 0; i < 2; i++ {
+		if allowed, _ := limiter.allow("ip", limit, nil); !allowed {
+			t.Fatalf("allow() #%d = false, want the burst allowed", i+1)
+		}
+	}
+	allowed, retryAfter := limiter.allow("ip", limit, nil)
+	if allowed || retryAfter != time.Second {
+		t.Errorf("allow() over the burst = %v, %v, want false, 1s", allowed, retryAfter)
+	}
+	if allowed, _ := limiter.allow("other", limit, nil); !allowed {
+		t.Errorf("allow() for another key = false, want its own bucket")
+	}
+
+	now = now.Add(500 * time.Millisecond)
+	if _, retryAfter := limiter.allow("ip", limit, nil); retryAfter != 500*time.Millisecond {
+		t.Errorf("retryAfter half way through the refill = %v, want 500ms", retryAfter)
+	}
+	now = now.Add(500 * time.Millisecond)
+	if allowed, _ := limiter.allow("ip", limit, nil); !allowed {
+		t.Errorf("allow() after a refill = false, want true")
+	}
+}
+
+func TestRateLimiter_allowWaits(t *testing.T) {
+	limiter := newRateLimiter()
+	limit := config.RateLimit{PerMinute: 1200, Burst: 1, Wait: config.Duration(time.Second)}
+	if allowed, _ := limiter.allow("repo", limit, nil); !allowed {
+		t.Fatal("allow() = false for the first hook")
+	}
+	start := time.Now()
+	if allowed, _ := limiter.allow("repo", limit, nil); !allowed {
+		t.Errorf("allow() = false, want the hook queued until the next token")
+	}
+	if waited := time.Since(start); waited < 40*time.Millisecond {
+		t.Errorf("allow() returned after %v, want it to wait for the next token", waited)
+	}
+
+	stop := make(chan struct{})
+	close(stop)
+	limit.PerMinute = 1
+	limiter.allow("slow", limit, stop)
+	if allowed, _ := limiter.allow("slow", limit, stop); allowed {
+		t.Errorf("allow() = true after stop, want false")
+	}
+}
+
+func TestRateLimiter_maxBuckets(t *testing.T) {
+	limiter := newRateLimiter()
+	limiter.maxBuckets = 3
+	limit := config.RateLimit{PerMinute: 1}
+
+	// Drained buckets are dropped too, the least recently used first
+	for _, key := range []string{"a", "b", "c", "a", "d", "e"} {
+		limiter.allow(key, limit, nil)
+		if size := limiter.size(); size > limiter.maxBuckets {
+			t.Fatalf("size() = %d after %s, want at most %d", size, key, limiter.maxBuckets)
+		}
+	}
+	if allowed, _ := limiter.allow("a", limit, nil); allowed {
+		t.Errorf("allow() for a recently used key = true, want its drained bucket kept")
+	}
+	if allowed, _ := limiter.allow("b", limit, nil); !allowed {
+		t.Errorf("allow() for the least recently used key = false, want its bucket dropped")
+	}
+
+	limiter.reset()
+	if size := limiter.size(); size != 0 {
+		t.Errorf("size() after reset() = %d, want 0", size)
+	}
+}
+
+func TestClientIP(t *testing.T) {
+	tests := []struct {
+		name              string
+		forwardedFor      []string
+		trustForwardedFor bool
+		want              string
+	}{
+		{"RemoteAddr", nil, true, "192.0.2.1"},
+		{"UntrustedForwardedFor", []string{"198.51.100.7"}, false, "192.0.2.1"},
+		{"ForwardedFor", []string{"198.51.100.7"}, true, "198.51.100.7"},
+		{"SpoofedLeadingAddress", []string{"203.0.113.99, 198.51.100.7"}, true, "198.51.100.7"},
+		{"SeveralHeaders", []string{"203.0.113.99", "198.51.100.7"}, true, "198.51.100.7"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodPost, "/hook", nil)
+			r.RemoteAddr = "192.0.2.1:51234"
+			for _, value := range tt.forwardedFor {
+				r.Header.Add("X-Forwarded-For", value)
+			}
+			if got := clientIP(r, tt.trustForwardedFor); got != tt.want {
+				t.Errorf("clientIP() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestProxy_proxyRequestRateLimits(t *testing.T) {
+	hits := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits++
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	newRouter := func(rule config.RateLimitRule) http.Handler {
+		p, err := NewProxy([]string{server.URL}, []string{}, providers.GitlabProviderKind, "", []string{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		p.ApplyConfig(&config.Config{RateLimits: []config.RateLimitRule{rule}})
+		return p.newRouter()
+	}
+	oncePerHour := config.RateLimit{PerMinute: 1.0 / 60, Burst: 1}
+	push := func(repository string, forwardedFor string) *http.Request {
+		req := createGitlabRequest(http.MethodPost, "/post", "", proxyGitlabTestEvent,
+			`{"project":{"path_with_namespace":"`+repository+`"}}`)
+		req.Header.Set("X-Forwarded-For", forwardedFor)
+		return req
+	}
+
+	tests := []struct {
+		name     string
+		rule     config.RateLimitRule
+		requests []*http.Request
+		want     []int
+	}{
+		{
+			name:     "ClientIP",
+			rule:     config.RateLimitRule{IP: oncePerHour},
+			requests: []*http.Request{push("a/one", "10.0.0.1"), push("a/two", "10.0.0.2")},
+			want:     []int{http.StatusOK, http.StatusTooManyRequests},
+		},
+		{
+			name:     "ForwardedClientIP",
+			rule:     config.RateLimitRule{IP: oncePerHour, TrustForwardedFor: true},
+			requests: []*http.Request{push("a/one", "10.0.0.1"), push("a/one", "10.0.0.2"), push("a/one", "10.0.0.1")},
+			want:     []int{http.StatusOK, http.StatusOK, http.StatusTooManyRequests},
+		},
+		{
+			name: "SpoofedForwardedClientIP",
+			rule: config.RateLimitRule{IP: oncePerHour, TrustForwardedFor: true},
+			requests: []*http.Request{
+				push("a/one", "203.0.113.1, 10.0.0.1"),
+				push("a/one", "203.0.113.2, 10.0.0.1"),
+			},
+			want: []int{http.StatusOK, http.StatusTooManyRequests},
+		},
+		{
+			name:     "Repository",
+			rule:     config.RateLimitRule{Repository: oncePerHour},
+			requests: []*http.Request{push("a/one", ""), push("a/two", ""), push("a/one", "")},
+			want:     []int{http.StatusOK, http.StatusOK, http.StatusTooManyRequests},
+		},
+		{
+			name:     "Upstream",
+			rule:     config.RateLimitRule{Upstream: oncePerHour},
+			requests: []*http.Request{push("a/one", ""), push("a/two", "")},
+			want:     []int{http.StatusOK, http.StatusTooManyRequests},
+		},
+		{
+			name:     "OtherPath",
+			rule:     config.RateLimitRule{Paths: mustParsePatterns(t, "/jenkins/**"), IP: oncePerHour},
+			requests: []*http.Request{push("a/one", ""), push("a/one", "")},
+			want:     []int{http.StatusOK, http.StatusOK},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			router := newRouter(tt.rule)
+			for i, req := range tt.requests {
+				rr := httptest.NewRecorder()
+				router.ServeHTTP(rr, req)
+				if rr.Code != tt.want[i] {
+					t.Errorf("request #%d got %v %q, want %v", i+1, rr.Code, rr.Body.String(), tt.want[i])
+				}
+				if rr.Code == http.StatusTooManyRequests && rr.Header().Get("Retry-After") != "3600" {
+					t.Errorf("Retry-After = %q, want 3600", rr.Header().Get("Retry-After"))
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,133 @@
+package proxy
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"time"
+)
+
+// beginDelivery registers an in-flight delivery. It returns false once the
+// listeners are closed, in which case no new work must be started.
+func (p *Proxy) beginDelivery() bool {
+	p.drainMu.Lock()
+	defer p.drainMu.Unlock()
+	if p.closed {
+		return false
+	}
+	p.inFlight.Add(1)
+	p.inFlightCount++
+	return true
+}
+
+// endDelivery marks a delivery registered with beginDelivery as finished
+func (p *Proxy) endDelivery() {
+	p.drainMu.Lock()
+	p.inFlightCount--
+	p.drainMu.Unlock()
+	p.inFlight.Done()
+}
+
+// inFlightDeliveries returns the number of deliveries registered with beginDelivery
+func (p *Proxy) inFlightDeliveries() int {
+	p.drainMu.Lock()
+	defer p.drainMu.Unlock()
+	return p.inFlightCount
+}
+
+func (p *Proxy) isDraining() bool {
+	p.drainMu.Lock()
+	defer p.drainMu.Unlock()
+	return p.draining
+}
+
+// trackServer records a server so Shutdown can stop it. It returns false if
+// the proxy is already shutting down and the server must not be started.
+func (p *Proxy) trackServer(server *http.Server) bool {
+	p.drainMu.Lock()
+	defer p.drainMu.Unlock()
+	if p.draining {
+		return false
+	}
+	p.servers = append(p.servers, server)
+	return true
+}
+
+// stopped returns a channel that is closed once Shutdown starts, for
+// background work that must stop with the proxy
+func (p *Proxy) stopped() <-chan struct{} {
+	p.drainMu.Lock()
+	defer p.drainMu.Unlock()
+	if p.done == nil {
+		p.done = make(chan struct{})
+	}
+	return p.done
+}
+
+func ignoreServerClosed(err error) error {
+	if err == http.ErrServerClosed {
+		return nil
+	}
+	return err
+}
+
+// Shutdown fails the health check while the listeners keep serving hooks for
+// drainDelay, giving Kubernetes time to remove the pod from its endpoints
+// without losing the hooks still routed to it. It then closes the listeners
+// and waits until in-flight deliveries have finished or ctx expires,
+// whichever comes first.
+func (p *Proxy) Shutdown(ctx context.Context, drainDelay time.Duration) error {
+	p.drainMu.Lock()
+	if !p.draining {
+		if p.done == nil {
+			p.done = make(chan struct{})
+		}
+		close(p.done)
+	}
+	p.draining = true
+	servers := p.servers
+	p.drainMu.Unlock()
+
+	if drainDelay > 0 {
+		log.Printf("Shutting down, failing readiness for %s before closing listeners", drainDelay)
+		timer := time.NewTimer(drainDelay)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+		}
+	}
+
+	log.Printf("Closing listeners, draining in-flight deliveries")
+
+	var shutdownErr error
+	for _, server := range servers {
+		if err := server.Shutdown(ctx); err != nil && shutdownErr == nil {
+			shutdownErr = err
+		}
+	}
+
+	// Hooks are accepted until the listeners are closed, new deliveries must
+	// not start once the wait below has begun
+	p.drainMu.Lock()
+	p.closed = true
+	p.drainMu.Unlock()
+
+	drained := make(chan struct{})
+	go func() {
+		p.inFlight.Wait()
+		close(drained)
+	}()
+
+	select {
+	case <-drained:
+		log.Printf("All in-flight deliveries finished")
+	case <-ctx.Done():
+		log.Printf("Grace period expired before in-flight deliveries finished")
+		if shutdownErr == nil {
+			shutdownErr = ctx.Err()
+		}
+	}
+
+	return shutdownErr
+}
@@ -0,0 +1,158 @@
+package proxy
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stakater/GitWebhookProxy/pkg/providers"
+)
+
+func waitForDraining(t *testing.T, p *Proxy) {
+	deadline := time.Now().Add(5 * time.Second)
+	for !p.isDraining() {
+		if time.Now().After(deadline) {
+			t.Fatalf("proxy did not start draining")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestProxy_Shutdown(t *testing.T) {
+	release := make(chan struct{})
+	received := make(chan struct{})
+	var hooks int32
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Only the first hook is held until released
+		if atomic.AddInt32(&hooks, 1) == 1 {
+			close(received)
+			<-release
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer upstream.Close()
+
+	p, err := NewProxy([]string{upstream.URL}, []string{}, providers.GitlabProviderKind, "", []string{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	router := p.newRouter()
+
+	inFlight := httptest.NewRecorder()
+	handled := make(chan struct{})
+	go func() {
+		router.ServeHTTP(inFlight, createGitlabRequest(http.MethodPost, "/post", "", proxyGitlabTestEvent, "{}"))
+		close(handled)
+	}()
+	<-received
+
+	shutdownDone := make(chan error)
+	go func() {
+		shutdownDone <- p.Shutdown(context.Background(), 50*time.Millisecond)
+	}()
+	waitForDraining(t, p)
+
+	// The pod may still be listed in the endpoints during the delay, so
+	// hooks routed to it are forwarded rather than lost
+	forwarded := httptest.NewRecorder()
+	router.ServeHTTP(forwarded, createGitlabRequest(http.MethodPost, "/post", "", proxyGitlabTestEvent, "{}"))
+	if forwarded.Code != http.StatusOK {
+		t.Errorf("new hook during drain delay got status %v, want %v", forwarded.Code, http.StatusOK)
+	}
+
+	health := httptest.NewRecorder()
+	healthReq, _ := http.NewRequest(http.MethodGet, "/health", nil)
+	router.ServeHTTP(health, healthReq)
+	if health.Code != http.StatusServiceUnavailable {
+		t.Errorf("health during shutdown got status %v, want %v", health.Code, http.StatusServiceUnavailable)
+	}
+
+	select {
+	case <-shutdownDone:
+		t.Fatalf("Shutdown() returned before the in-flight delivery finished")
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	close(release)
+	select {
+	case err := <-shutdownDone:
+		if err != nil {
+			t.Errorf("Shutdown() error = %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("Shutdown() did not return after the in-flight delivery finished")
+	}
+	<-handled
+	if inFlight.Code != http.StatusOK {
+		t.Errorf("in-flight hook got status %v, want %v", inFlight.Code, http.StatusOK)
+	}
+
+	rejected := httptest.NewRecorder()
+	router.ServeHTTP(rejected, createGitlabRequest(http.MethodPost, "/post", "", proxyGitlabTestEvent, "{}"))
+	if rejected.Code != http.StatusServiceUnavailable {
+		t.Errorf("new hook after shutdown got status %v, want %v", rejected.Code, http.StatusServiceUnavailable)
+	}
+}
+
+func TestProxy_ShutdownKeepsServingDuringDrainDelay(t *testing.T) {
+	p, err := NewProxy([]string{"http://127.0.0.1:0"}, []string{}, providers.GitlabProviderKind, "", []string{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := httptest.NewServer(p.newRouter())
+	defer server.Close()
+	p.trackServer(server.Config)
+
+	shutdownDone := make(chan error)
+	go func() {
+		shutdownDone <- p.Shutdown(context.Background(), 200*time.Millisecond)
+	}()
+	waitForDraining(t, p)
+
+	// The listener is still open, so Kubernetes sees the failing probe
+	// instead of a refused connection
+	resp, err := http.Get(server.URL + "/health")
+	if err != nil {
+		t.Fatalf("health during drain delay failed: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusServiceUnavailable {
+		t.Errorf("health during drain delay got status %v, want %v", resp.StatusCode, http.StatusServiceUnavailable)
+	}
+
+	select {
+	case err := <-shutdownDone:
+		if err != nil {
+			t.Errorf("Shutdown() error = %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("Shutdown() did not return after the drain delay")
+	}
+}
+
+func TestProxy_ShutdownGracePeriodExpires(t *testing.T) {
+	release := make(chan struct{})
+	received := make(chan struct{})
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(received)
+		<-release
+	}))
+	defer upstream.Close()
+	defer close(release)
+
+	p, err := NewProxy([]string{upstream.URL}, []string{}, providers.GitlabProviderKind, "", []string{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	go p.newRouter().ServeHTTP(httptest.NewRecorder(), createGitlabRequest(http.MethodPost, "/post", "", proxyGitlabTestEvent, "{}"))
+	<-received
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if err := p.Shutdown(ctx, time.Second); err != context.DeadlineExceeded {
+		t.Errorf("Shutdown() error = %v, want %v", err, context.DeadlineExceeded)
+	}
+}
@@ -0,0 +1,259 @@
+package proxy
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+const defaultTLSReloadInterval = time.Second * 30
+
+// TLSOptions configures the HTTPS listener started by RunTLS
+type TLSOptions struct {
+	CertFile string
+	KeyFile  string
+	// ClientCAFile enables client certificate verification when set
+	ClientCAFile string
+	// ClientAuth is one of none, request, require, verify-if-given or require-and-verify
+	ClientAuth   string
+	MinVersion   string
+	MaxVersion   string
+	CipherSuites []string
+	// ReloadInterval is how often cert, key and client CA files are checked for changes
+	ReloadInterval time.Duration
+}
+
+var tlsVersions = map[string]uint16{
+	"1.0": tls.VersionTLS10,
+	"1.1": tls.VersionTLS11,
+	"1.2": tls.VersionTLS12,
+	"1.3": tls.VersionTLS13,
+}
+
+var tlsClientAuthTypes = map[string]tls.ClientAuthType{
+	"":                   tls.NoClientCert,
+	"none":               tls.NoClientCert,
+	"request":            tls.RequestClientCert,
+	"require":            tls.RequireAnyClientCert,
+	"verify-if-given":    tls.VerifyClientCertIfGiven,
+	"require-and-verify": tls.RequireAndVerifyClientCert,
+}
+
+func parseTLSVersion(version string, fallback uint16) (uint16, error) {
+	version = strings.TrimSpace(version)
+	if len(version) == 0 {
+		return fallback, nil
+	}
+	if v, ok := tlsVersions[version]; ok {
+		return v, nil
+	}
+	return 0, fmt.Errorf("unknown TLS version '%s'", version)
+}
+
+func parseCipherSuites(names []string) ([]uint16, error) {
+	known := make(map[string]uint16)
+	for _, suite := range tls.CipherSuites() {
+		known[suite.Name] = suite.ID
+	}
+	insecure := make(map[string]bool)
+	for _, suite := range tls.InsecureCipherSuites() {
+		insecure[suite.Name] = true
+	}
+
+	var ids []uint16
+	for _, name := range names {
+		name = strings.TrimSpace(name)
+		if len(name) == 0 {
+			continue
+		}
+		if insecure[name] {
+			return nil, fmt.Errorf("insecure TLS cipher suite '%s' is not allowed", name)
+		}
+		id, ok := known[name]
+		if !ok {
+			return nil, fmt.Errorf("unknown TLS cipher suite '%s'", name)
+		}
+		ids = append(ids, id)
+	}
+	return ids, nil
+}
+
+// newTLSConfig builds the server tls.Config. Certificates and client CAs are
+// resolved per handshake from the reloader so rotated files are picked up
+// without restarting the listener.
+func newTLSConfig(opts TLSOptions, reloader *certReloader) (*tls.Config, error) {
+	minVersion, err := parseTLSVersion(opts.MinVersion, tls.VersionTLS12)
+	if err != nil {
+		return nil, err
+	}
+	maxVersion, err := parseTLSVersion(opts.MaxVersion, 0)
+	if err != nil {
+		return nil, err
+	}
+	cipherSuites, err := parseCipherSuites(opts.CipherSuites)
+	if err != nil {
+		return nil, err
+	}
+	clientAuth, ok := tlsClientAuthTypes[strings.ToLower(strings.TrimSpace(opts.ClientAuth))]
+	if !ok {
+		return nil, fmt.Errorf("unknown TLS client auth type '%s'", opts.ClientAuth)
+	}
+	if len(opts.ClientCAFile) > 0 && clientAuth == tls.NoClientCert {
+		clientAuth = tls.RequireAndVerifyClientCert
+	}
+	// request and require accept any certificate, a client CA file would
+	// suggest that certificates are verified while they are not
+	if (clientAuth == tls.RequestClientCert || clientAuth == tls.RequireAnyClientCert) &&
+		len(opts.ClientCAFile) > 0 {
+		return nil, fmt.Errorf("TLS client auth type '%s' does not verify client certificates against the client CA file, use verify-if-given or require-and-verify", opts.ClientAuth)
+	}
+	if (clientAuth == tls.VerifyClientCertIfGiven || clientAuth == tls.RequireAndVerifyClientCert) &&
+		len(opts.ClientCAFile) == 0 {
+		return nil, errors.New("TLS client certificate verification requires a client CA file")
+	}
+
+	base := &tls.Config{
+		MinVersion:   minVersion,
+		MaxVersion:   maxVersion,
+		ClientAuth:   clientAuth,
+		NextProtos:   []string{"h2", "http/1.1"},
+		CipherSuites: cipherSuites,
+	}
+
+	config := base.Clone()
+	config.GetConfigForClient = func(*tls.ClientHelloInfo) (*tls.Config, error) {
+		cert, clientCAs := reloader.current()
+		c := base.Clone()
+		c.Certificates = []tls.Certificate{*cert}
+		c.ClientCAs = clientCAs
+		return c, nil
+	}
+	return config, nil
+}
+
+// certReloader keeps the serving certificate and client CA pool in sync with
+// the files on disk, e.g. when cert-manager rotates a mounted secret
+type certReloader struct {
+	certFile     string
+	keyFile      string
+	clientCAFile string
+
+	mu        sync.RWMutex
+	cert      *tls.Certificate
+	clientCAs *x509.CertPool
+	modTimes  map[string]time.Time
+}
+
+func newCertReloader(certFile string, keyFile string, clientCAFile string) (*certReloader, error) {
+	if len(strings.TrimSpace(certFile)) == 0 || len(strings.TrimSpace(keyFile)) == 0 {
+		return nil, errors.New("cannot serve TLS without both a certificate and a key file")
+	}
+
+	r := &certReloader{
+		certFile:     certFile,
+		keyFile:      keyFile,
+		clientCAFile: clientCAFile,
+	}
+	if err := r.reload(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+func (r *certReloader) files() []string {
+	files := []string{r.certFile, r.keyFile}
+	if len(r.clientCAFile) > 0 {
+		files = append(files, r.clientCAFile)
+	}
+	return files
+}
+
+func (r *certReloader) reload() error {
+	modTimes := make(map[string]time.Time)
+	for _, file := range r.files() {
+		info, err := os.Stat(file)
+		if err != nil {
+			return err
+		}
+		modTimes[file] = info.ModTime()
+	}
+
+	cert, err := tls.LoadX509KeyPair(r.certFile, r.keyFile)
+	if err != nil {
+		return err
+	}
+
+	var clientCAs *x509.CertPool
+	if len(r.clientCAFile) > 0 {
+		pem, err := ioutil.ReadFile(r.clientCAFile)
+		if err != nil {
+			return err
+		}
+		clientCAs = x509.NewCertPool()
+		if !clientCAs.AppendCertsFromPEM(pem) {
+			return fmt.Errorf("no certificates found in client CA file '%s'", r.clientCAFile)
+		}
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.cert = &cert
+	r.clientCAs = clientCAs
+	r.modTimes = modTimes
+	return nil
+}
+
+func (r *certReloader) changed() bool {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	for _, file := range r.files() {
+		info, err := os.Stat(file)
+		if err != nil {
+			// The file may be mid-rotation, try again on the next tick
+			return false
+		}
+		if !info.ModTime().Equal(r.modTimes[file]) {
+			return true
+		}
+	}
+	return false
+}
+
+func (r *certReloader) current() (*tls.Certificate, *x509.CertPool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.cert, r.clientCAs
+}
+
+// watch polls the files until stop is closed and reloads them when they change.
+// A failed reload keeps serving the previous certificate.
+func (r *certReloader) watch(interval time.Duration, stop <-chan struct{}) {
+	if interval <= 0 {
+		interval = defaultTLSReloadInterval
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			if !r.changed() {
+				continue
+			}
+			if err := r.reload(); err != nil {
+				log.Printf("Error reloading TLS certificates: %s", err)
+				continue
+			}
+			log.Printf("Reloaded TLS certificate from '%s'", r.certFile)
+		}
+	}
+}
@@ -0,0 +1,295 @@
+package proxy
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func writeTestCertificate(t *testing.T, dir string, commonName string) (string, string) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(time.Now().UnixNano()),
+		Subject:               pkix.Name{CommonName: commonName},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		DNSNames:              []string{"localhost"},
+		IPAddresses:           []net.IP{net.ParseIP("127.0.0.1")},
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDer, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	certFile := filepath.Join(dir, "tls.crt")
+	keyFile := filepath.Join(dir, "tls.key")
+	if err := ioutil.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer}), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return certFile, keyFile
+}
+
+func TestCertReloader_reload(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gwp-tls")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	certFile, keyFile := writeTestCertificate(t, dir, "first")
+	reloader, err := newCertReloader(certFile, keyFile, "")
+	if err != nil {
+		t.Fatalf("newCertReloader() error = %v", err)
+	}
+	if reloader.changed() {
+		t.Errorf("certReloader.changed() = true right after loading")
+	}
+
+	writeTestCertificate(t, dir, "second")
+	future := time.Now().Add(time.Minute)
+	os.Chtimes(certFile, future, future)
+	if !reloader.changed() {
+		t.Fatalf("certReloader.changed() = false after certificate was rewritten")
+	}
+	if err := reloader.reload(); err != nil {
+		t.Fatalf("certReloader.reload() error = %v", err)
+	}
+
+	cert, _ := reloader.current()
+	leaf, err := x509.ParseCertificate(cert.Certificate[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if leaf.Subject.CommonName != "second" {
+		t.Errorf("certReloader.current() CommonName = %v, want second", leaf.Subject.CommonName)
+	}
+}
+
+func TestNewCertReloaderWithMissingFiles(t *testing.T) {
+	if _, err := newCertReloader("", "", ""); err == nil {
+		t.Errorf("newCertReloader() with empty files should fail")
+	}
+	if _, err := newCertReloader("/nonexistent/tls.crt", "/nonexistent/tls.key", ""); err == nil {
+		t.Errorf("newCertReloader() with missing files should fail")
+	}
+}
+
+func TestNewTLSConfig(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gwp-tls")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	certFile, keyFile := writeTestCertificate(t, dir, "ca")
+	reloader, err := newCertReloader(certFile, keyFile, certFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name           string
+		opts           TLSOptions
+		wantClientAuth tls.ClientAuthType
+		wantMinVersion uint16
+		wantErr        bool
+	}{
+		{
+			name:           "DefaultsWithClientCA",
+			opts:           TLSOptions{ClientCAFile: certFile},
+			wantClientAuth: tls.RequireAndVerifyClientCert,
+			wantMinVersion: tls.VersionTLS12,
+		},
+		{
+			name:           "OptionalClientCert",
+			opts:           TLSOptions{ClientCAFile: certFile, ClientAuth: "verify-if-given", MinVersion: "1.3"},
+			wantClientAuth: tls.VerifyClientCertIfGiven,
+			wantMinVersion: tls.VersionTLS13,
+		},
+		{
+			name:    "VerifyWithoutClientCA",
+			opts:    TLSOptions{ClientAuth: "require-and-verify"},
+			wantErr: true,
+		},
+		{
+			name:    "RequestWithClientCA",
+			opts:    TLSOptions{ClientCAFile: certFile, ClientAuth: "request"},
+			wantErr: true,
+		},
+		{
+			name:    "RequireAnyWithClientCA",
+			opts:    TLSOptions{ClientCAFile: certFile, ClientAuth: "Require"},
+			wantErr: true,
+		},
+		{
+			name:           "RequireAnyWithoutClientCA",
+			opts:           TLSOptions{ClientAuth: "require"},
+			wantClientAuth: tls.RequireAnyClientCert,
+			wantMinVersion: tls.VersionTLS12,
+		},
+		{
+			name:    "UnknownVersion",
+			opts:    TLSOptions{MinVersion: "2.0"},
+			wantErr: true,
+		},
+		{
+			name:    "UnknownCipherSuite",
+			opts:    TLSOptions{CipherSuites: []string{"TLS_NOT_A_CIPHER"}},
+			wantErr: true,
+		},
+		{
+			name:    "InsecureCipherSuite",
+			opts:    TLSOptions{CipherSuites: []string{"TLS_RSA_WITH_RC4_128_SHA"}},
+			wantErr: true,
+		},
+		{
+			name:           "KnownCipherSuite",
+			opts:           TLSOptions{CipherSuites: []string{"TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256"}},
+			wantClientAuth: tls.NoClientCert,
+			wantMinVersion: tls.VersionTLS12,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := newTLSConfig(tt.opts, reloader)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("newTLSConfig() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if got.ClientAuth != tt.wantClientAuth {
+				t.Errorf("newTLSConfig() ClientAuth = %v, want %v", got.ClientAuth, tt.wantClientAuth)
+			}
+			if got.MinVersion != tt.wantMinVersion {
+				t.Errorf("newTLSConfig() MinVersion = %v, want %v", got.MinVersion, tt.wantMinVersion)
+			}
+			perClient, err := got.GetConfigForClient(&tls.ClientHelloInfo{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(perClient.Certificates) != 1 {
+				t.Errorf("GetConfigForClient() returned %d certificates, want 1", len(perClient.Certificates))
+			}
+		})
+	}
+}
+
+func TestRunTLSWithClientCertificates(t *testing.T) {
+	serverDir, err := ioutil.TempDir("", "gwp-tls-server")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(serverDir)
+	clientDir, err := ioutil.TempDir("", "gwp-tls-client")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(clientDir)
+
+	serverCertFile, serverKeyFile := writeTestCertificate(t, serverDir, "first")
+	// The self-signed client certificate doubles as the client CA
+	clientCertFile, clientKeyFile := writeTestCertificate(t, clientDir, "client")
+
+	reloader, err := newCertReloader(serverCertFile, serverKeyFile, clientCertFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tlsConfig, err := newTLSConfig(TLSOptions{ClientCAFile: clientCertFile, ClientAuth: "require-and-verify"}, reloader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	listener, err := tls.Listen("tcp", "127.0.0.1:0", tlsConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := &http.Server{
+		Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusOK)
+		}),
+	}
+	go server.Serve(listener)
+	defer server.Close()
+	url := "https://" + listener.Addr().String() + "/health"
+
+	newClient := func(certificates []tls.Certificate) *http.Client {
+		return &http.Client{
+			Timeout: 5 * time.Second,
+			Transport: &http.Transport{
+				DisableKeepAlives: true,
+				TLSClientConfig: &tls.Config{
+					Certificates:       certificates,
+					InsecureSkipVerify: true,
+				},
+			},
+		}
+	}
+	servedCommonName := func(resp *http.Response) string {
+		return resp.TLS.PeerCertificates[0].Subject.CommonName
+	}
+
+	if resp, err := newClient(nil).Get(url); err == nil {
+		resp.Body.Close()
+		t.Fatalf("request without a client certificate succeeded, want handshake failure")
+	}
+
+	clientCert, err := tls.LoadX509KeyPair(clientCertFile, clientKeyFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client := newClient([]tls.Certificate{clientCert})
+	resp, err := client.Get(url)
+	if err != nil {
+		t.Fatalf("request with a valid client certificate failed: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("request with a valid client certificate got status %v, want %v", resp.StatusCode, http.StatusOK)
+	}
+	if got := servedCommonName(resp); got != "first" {
+		t.Errorf("served certificate CommonName = %v, want first", got)
+	}
+
+	writeTestCertificate(t, serverDir, "second")
+	future := time.Now().Add(time.Minute)
+	os.Chtimes(serverCertFile, future, future)
+	if err := reloader.reload(); err != nil {
+		t.Fatal(err)
+	}
+
+	resp, err = client.Get(url)
+	if err != nil {
+		t.Fatalf("request after reload failed: %v", err)
+	}
+	resp.Body.Close()
+	if got := servedCommonName(resp); got != "second" {
+		t.Errorf("served certificate CommonName after reload = %v, want second", got)
+	}
+}
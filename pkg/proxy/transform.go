@@ -0,0 +1,71 @@
+package proxy
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"text/template"
+
+	"github.com/stakater/GitWebhookProxy/pkg/config"
+)
+
+// transformRequest rewrites the request forwarding a hook with the body and
+// headers templates of an upstream
+func transformRequest(req *http.Request, transform config.Transform, in *filterInput) error {
+	if transform.Body.Empty() && len(transform.Headers) == 0 {
+		return nil
+	}
+
+	data, funcs := templateInput(in)
+	for name, header := range transform.Headers {
+		value, err := header.Execute(data, funcs)
+		if err != nil {
+			return fmt.Errorf("header '%s' template failed: %s", name, err)
+		}
+		req.Header.Set(name, value)
+	}
+	if !transform.Body.Empty() {
+		body, err := transform.Body.Execute(data, funcs)
+		if err != nil {
+			return fmt.Errorf("body template failed: %s", err)
+		}
+		setRequestBody(req, []byte(body))
+	}
+	return nil
+}
+
+// templateInput returns the data and config.TemplateHookFuncs that templates
+// are executed with for a hook
+func templateInput(in *filterInput) (interface{}, template.FuncMap) {
+	env := in.templateVariables()
+	funcs := template.FuncMap{
+		"header": func(name string) string {
+			if in.hook == nil {
+				return ""
+			}
+			return in.hook.Header(name)
+		},
+		"event":      func() interface{} { return env["event"] },
+		"provider":   func() interface{} { return env["provider"] },
+		"normalized": func() interface{} { return env["normalized"] },
+	}
+	return env["payload"], funcs
+}
+
+// setRequestBody replaces the body of a request that has not been sent yet
+func setRequestBody(req *http.Request, body []byte) {
+	req.Body = ioutil.NopCloser(bytes.NewReader(body))
+	req.ContentLength = int64(len(body))
+	req.GetBody = func() (io.ReadCloser, error) {
+		return ioutil.NopCloser(bytes.NewReader(body)), nil
+	}
+}
+
+// transform returns the request transform of the upstream
+func (u *upstream) transform() config.Transform {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	return u.config.Transform
+}
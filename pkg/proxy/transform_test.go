@@ -0,0 +1,76 @@
+package proxy
+
+import (
+	"io/ioutil"
+	"testing"
+
+	"github.com/stakater/GitWebhookProxy/pkg/config"
+	"github.com/stakater/GitWebhookProxy/pkg/providers"
+)
+
+func mustParseTemplate(t *testing.T, source string) config.Template {
+	tmpl, err := config.ParseTemplate(source)
+	if err != nil {
+		t.Fatalf("ParseTemplate(%q) error = %v", source, err)
+	}
+	return tmpl
+}
+
+func TestTransformRequest(t *testing.T) {
+	hook := &providers.Hook{
+		Payload: []byte(`{"ref":"refs/heads/feature/x","repository":{"id":123456789,"name":"app"}}`),
+		Headers: map[string]string{
+			providers.XGitHubEvent: "push",
+			"X-GitHub-Delivery":    "1234",
+			"Content-Type":         "application/json",
+		},
+		RequestMethod: "POST",
+	}
+	in := newFilterInput(&providers.GithubProvider{}, hook)
+	req, err := newRedirectRequest(hook, "http://jenkins/job/app/buildWithParameters")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	transform := config.Transform{
+		Body: mustParseTemplate(t, `BRANCH={{.ref | trimPrefix "refs/heads/" | urlquery}}&REPO={{.repository.name}}&ID={{.repository.id}}&KIND={{normalized.kind}}`),
+		Headers: map[string]config.Template{
+			"Content-Type": mustParseTemplate(t, "application/x-www-form-urlencoded"),
+			"X-Delivery":   mustParseTemplate(t, `{{event}}/{{header "x-github-delivery"}}`),
+			"X-Repository": mustParseTemplate(t, `{{json .repository}}`),
+		},
+	}
+	if err := transformRequest(req, transform, in); err != nil {
+		t.Fatalf("transformRequest() error = %v", err)
+	}
+
+	body, _ := ioutil.ReadAll(req.Body)
+	if want := "BRANCH=feature%2Fx&REPO=app&ID=123456789&KIND=push"; string(body) != want {
+		t.Errorf("body = %q, want %q", body, want)
+	}
+	if req.ContentLength != int64(len(body)) {
+		t.Errorf("ContentLength = %d, want %d", req.ContentLength, len(body))
+	}
+	if got := req.Header.Get("Content-Type"); got != "application/x-www-form-urlencoded" {
+		t.Errorf("Content-Type = %q", got)
+	}
+	if got := req.Header.Get("X-Delivery"); got != "push/1234" {
+		t.Errorf("X-Delivery = %q, want push/1234", got)
+	}
+	if got := req.Header.Get("X-Repository"); got != `{"id":123456789,"name":"app"}` {
+		t.Errorf("X-Repository = %q", got)
+	}
+}
+
+func TestTransformRequestMissingField(t *testing.T) {
+	hook := &providers.Hook{Payload: []byte(`{"ref":"refs/heads/main"}`), Headers: map[string]string{}, RequestMethod: "POST"}
+	in := newFilterInput(&providers.GithubProvider{}, hook)
+	req, err := newRedirectRequest(hook, "http://jenkins/build")
+	if err != nil {
+		t.Fatal(err)
+	}
+	transform := config.Transform{Body: mustParseTemplate(t, "{{.repository.name}}")}
+	if err := transformRequest(req, transform, in); err == nil {
+		t.Errorf("transformRequest() error = nil, want an error for a missing field")
+	}
+}
@@ -0,0 +1,259 @@
+package proxy
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/stakater/GitWebhookProxy/pkg/config"
+)
+
+// upstream holds the runtime state the proxy keeps for one upstream URL
+type upstream struct {
+	url string
+	// urlTemplate is set for URLs with placeholders, see config.ParseURLTemplate
+	urlTemplate config.Template
+
+	mu                  sync.Mutex
+	healthURL           string
+	healthy             bool
+	probed              bool
+	lastChecked         time.Time
+	lastError           string
+	consecutiveFailures int
+	breaker             *circuitBreaker
+	config              config.Upstream
+	client              *http.Client
+	// paused upstreams are skipped until resumed through the admin API
+	paused bool
+}
+
+var errUpstreamPaused = errors.New("upstream is paused")
+
+// UpstreamStatus is the JSON view of an upstream's current state
+type UpstreamStatus struct {
+	URL                 string     `json:"url"`
+	HealthURL           string     `json:"healthURL,omitempty"`
+	Health              string     `json:"health"`
+	LastChecked         *time.Time `json:"lastChecked,omitempty"`
+	LastError           string     `json:"lastError,omitempty"`
+	ConsecutiveFailures int        `json:"consecutiveFailures"`
+	Circuit             string     `json:"circuit,omitempty"`
+	Paused              bool       `json:"paused"`
+}
+
+const (
+	upstreamHealthy   = "healthy"
+	upstreamUnhealthy = "unhealthy"
+	upstreamUnknown   = "unknown"
+)
+
+func newUpstream(upstreamURL string) *upstream {
+	u := &upstream{url: upstreamURL}
+	if config.IsURLTemplate(upstreamURL) {
+		// The URL was checked by NewProxy or config.Validate
+		if tmpl, err := config.ParseURLTemplate(upstreamURL); err == nil {
+			u.urlTemplate = tmpl
+		}
+	}
+	return u
+}
+
+// redirectURL returns the URL a hook is forwarded to. A plain upstream URL
+// is followed by the path and query of the request, a templated one is used
+// as rendered.
+func (u *upstream) redirectURL(requestURL *url.URL, in *filterInput) (string, error) {
+	if !u.urlTemplate.Empty() {
+		data, funcs := templateInput(in)
+		return u.urlTemplate.Execute(data, funcs)
+	}
+	redirectURL := u.url + requestURL.Path
+	if requestURL.RawQuery != "" {
+		redirectURL += "?" + requestURL.RawQuery
+	}
+	return redirectURL, nil
+}
+
+func (u *upstream) status() UpstreamStatus {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	status := UpstreamStatus{
+		URL:                 u.url,
+		HealthURL:           u.healthURL,
+		Health:              upstreamUnknown,
+		LastError:           u.lastError,
+		ConsecutiveFailures: u.consecutiveFailures,
+		Circuit:             u.breaker.currentState(),
+		Paused:              u.paused,
+	}
+	if u.probed {
+		lastChecked := u.lastChecked
+		status.LastChecked = &lastChecked
+		status.Health = upstreamUnhealthy
+		if u.healthy {
+			status.Health = upstreamHealthy
+		}
+	}
+	return status
+}
+
+func (u *upstream) setPaused(paused bool) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	u.paused = paused
+}
+
+func (u *upstream) isPaused() bool {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	return u.paused
+}
+
+func (u *upstream) configure(cfg config.Upstream) {
+	u.mu.Lock()
+	previous := u.client
+	u.config = cfg
+	u.client = nil
+	if hasClientSettings(cfg) {
+		u.client = newUpstreamClient(cfg)
+	}
+	u.mu.Unlock()
+
+	// Requests in flight keep using the previous client, only its idle
+	// connections would otherwise be left open with every reload
+	if previous != nil {
+		previous.CloseIdleConnections()
+	}
+}
+
+// httpClient returns the upstream's dedicated client, or the shared one
+func (u *upstream) httpClient() *http.Client {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	if u.client != nil {
+		return u.client
+	}
+	return httpClient
+}
+
+// configuredHealthURL returns the upstream's own health URL, if configured
+func (u *upstream) configuredHealthURL() string {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	return u.config.HealthURL
+}
+
+func (u *upstream) setBreaker(opts CircuitBreakerOptions) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	u.breaker = nil
+	if opts.enabled() {
+		u.breaker = newCircuitBreaker(opts)
+	}
+}
+
+// circuit returns the upstream's circuit breaker, nil when disabled
+func (u *upstream) circuit() *circuitBreaker {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	return u.breaker
+}
+
+func (u *upstream) recordProbe(err error) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	u.probed = true
+	u.lastChecked = time.Now()
+	u.healthy = err == nil
+	if err != nil {
+		u.lastError = err.Error()
+		u.consecutiveFailures++
+		return
+	}
+	u.lastError = ""
+	u.consecutiveFailures = 0
+}
+
+// upstreamHealthURL resolves healthPath against the scheme and host of the
+// upstream URL, so that an upstream like https://jenkins/github-webhook/ is
+// probed at https://jenkins/login for a healthPath of /login
+func upstreamHealthURL(upstreamURL string, healthPath string) string {
+	healthPath = strings.TrimSpace(healthPath)
+	if len(healthPath) == 0 {
+		return ""
+	}
+	if strings.HasPrefix(healthPath, "http://") || strings.HasPrefix(healthPath, "https://") {
+		return healthPath
+	}
+
+	parsed, err := url.Parse(upstreamURL)
+	if err != nil || len(parsed.Host) == 0 {
+		return ""
+	}
+	if !strings.HasPrefix(healthPath, "/") {
+		healthPath = "/" + healthPath
+	}
+	return parsed.Scheme + "://" + parsed.Host + healthPath
+}
+
+// upstreamStates returns the runtime state for every configured upstream,
+// creating it on first use, in the order of p.upstreamURLs
+func (p *Proxy) upstreamStates() []*upstream {
+	p.upstreamsMu.Lock()
+	defer p.upstreamsMu.Unlock()
+
+	if p.upstreams == nil {
+		p.upstreams = make(map[string]*upstream)
+	}
+	states := make([]*upstream, 0, len(p.upstreamURLs))
+	for _, upstreamURL := range p.upstreamURLs {
+		u, ok := p.upstreams[upstreamURL]
+		if !ok {
+			u = newUpstream(upstreamURL)
+			u.setBreaker(p.breakerOptions)
+			u.configure(p.upstreamConfigs[upstreamURL])
+			p.upstreams[upstreamURL] = u
+		}
+		states = append(states, u)
+	}
+	return states
+}
+
+// SetUpstreamURLs replaces the upstreams hooks are forwarded to. Upstreams
+// that are kept keep their health, circuit and paused state.
+func (p *Proxy) SetUpstreamURLs(upstreamURLs []string) error {
+	if len(upstreamURLs) == 0 {
+		return errors.New("Cannot set an empty list of upstreamURLs")
+	}
+	for _, u := range upstreamURLs {
+		if len(strings.TrimSpace(u)) == 0 {
+			return errors.New("Cannot set an empty URL in upstreamURLs list")
+		}
+		if config.IsURLTemplate(u) {
+			if _, err := config.ParseURLTemplate(u); err != nil {
+				return fmt.Errorf("Cannot set an invalid URL template '%s' in upstreamURLs list: %s", u, err)
+			}
+		}
+	}
+
+	p.upstreamsMu.Lock()
+	defer p.upstreamsMu.Unlock()
+
+	kept := make(map[string]bool)
+	for _, u := range upstreamURLs {
+		kept[u] = true
+	}
+	for upstreamURL := range p.upstreams {
+		if !kept[upstreamURL] {
+			delete(p.upstreams, upstreamURL)
+		}
+	}
+	p.upstreamURLs = append([]string(nil), upstreamURLs...)
+	return nil
+}
@@ -0,0 +1,104 @@
+package proxy
+
+import (
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/stakater/GitWebhookProxy/pkg/config"
+	"github.com/stakater/GitWebhookProxy/pkg/providers"
+)
+
+func TestUpstream_redirectURL(t *testing.T) {
+	hook := &providers.Hook{
+		Payload: []byte(`{"ref":"refs/heads/feature/a&b=c","repository":{"id":123456789,"name":"my app/../admin"}}`),
+		Headers: map[string]string{providers.XGitHubEvent: "push"},
+	}
+	in := newFilterInput(&providers.GithubProvider{}, hook)
+	requestURL, _ := url.Parse("http://proxy/github-webhook/?token=abc")
+
+	tests := []struct {
+		name        string
+		upstreamURL string
+		want        string
+	}{
+		{
+			name:        "Plain",
+			upstreamURL: "http://jenkins",
+			want:        "http://jenkins/github-webhook/?token=abc",
+		},
+		{
+			name:        "Template",
+			upstreamURL: `http://jenkins/job/{{.repository.name}}/build?branch={{.ref | trimPrefix "refs/heads/"}}&event={{event}}`,
+			want:        "http://jenkins/job/my%20app%2F..%2Fadmin/build?branch=feature%2Fa%26b%3Dc&event=push",
+		},
+		{
+			name:        "TemplateWithNumber",
+			upstreamURL: `http://jenkins/job/{{.repository.id}}/build?id={{.repository.id}}`,
+			want:        "http://jenkins/job/123456789/build?id=123456789",
+		},
+		{
+			name:        "TemplateWithBranches",
+			upstreamURL: `http://jenkins/{{if .ref}}job/{{.repository.name}}?ref={{.ref}}{{end}}`,
+			want:        "http://jenkins/job/my%20app%2F..%2Fadmin?ref=refs%2Fheads%2Ffeature%2Fa%26b%3Dc",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := newUpstream(tt.upstreamURL).redirectURL(requestURL, in)
+			if err != nil {
+				t.Fatalf("redirectURL() error = %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("redirectURL() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestUpstream_redirectURLMissingField(t *testing.T) {
+	hook := &providers.Hook{Payload: []byte(`{}`), Headers: map[string]string{}}
+	in := newFilterInput(&providers.GithubProvider{}, hook)
+	requestURL, _ := url.Parse("http://proxy/")
+	if _, err := newUpstream("http://jenkins/job/{{.repository.name}}").redirectURL(requestURL, in); err == nil {
+		t.Errorf("redirectURL() error = nil, want an error for a missing field")
+	}
+}
+
+func TestUpstream_configureClosesIdleConnections(t *testing.T) {
+	closed := make(chan struct{}, 1)
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	server.Config.ConnState = func(conn net.Conn, state http.ConnState) {
+		if state == http.StateClosed {
+			select {
+			case closed <- struct{}{}:
+			default:
+			}
+		}
+	}
+	server.Start()
+	defer server.Close()
+
+	cfg := config.Upstream{URL: server.URL, Timeouts: config.Timeouts{Overall: config.Duration(5 * time.Second)}}
+	u := newUpstream(server.URL)
+	u.configure(cfg)
+	resp, err := u.httpClient().Get(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+
+	// A reload replaces the client, the idle connection of the previous one
+	// must not stay open
+	u.configure(cfg)
+	select {
+	case <-closed:
+	case <-time.After(5 * time.Second):
+		t.Errorf("idle connection of the previous client still open after configure()")
+	}
+}
@@ -0,0 +1,220 @@
+package replay
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+
+	"github.com/stakater/GitWebhookProxy/pkg/providers"
+	"github.com/stakater/GitWebhookProxy/pkg/proxy"
+)
+
+// XHubSignature256 is the SHA-256 signature GitHub sends next to XHubSignature
+const XHubSignature256 = "X-Hub-Signature-256"
+
+// skippedHeaders are set by the client for the replayed request
+var skippedHeaders = []string{"Host", "Content-Length", "Connection", "Transfer-Encoding"}
+
+// Hook is a stored hook to send again
+type Hook struct {
+	providers.Hook
+	// Path the hook was received on, e.g. /github-webhook/
+	Path string
+	// Provider is github or gitlab, read from the headers when empty
+	Provider string
+	// Name identifies the hook in the output, e.g. its delivery ID
+	Name string
+}
+
+// hookFile is the JSON form of a stored hook. The body is either a JSON
+// string holding the raw body or the JSON payload itself. The payload field
+// holds the body base64 encoded, as in the deliveries of the admin API.
+type hookFile struct {
+	Method   string            `json:"method"`
+	Path     string            `json:"path"`
+	Provider string            `json:"provider"`
+	Headers  map[string]string `json:"headers"`
+	Body     json.RawMessage   `json:"body"`
+	Payload  []byte            `json:"payload"`
+}
+
+// LoadFile reads a hook stored as JSON, see hookFile, or as an HTTP request
+// in wire format
+func LoadFile(path string) (*Hook, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	hook, err := Parse(data)
+	if err != nil {
+		return nil, fmt.Errorf("Error reading hook from '%s': %s", path, err)
+	}
+	hook.Name = path
+	return hook, nil
+}
+
+// Parse reads a hook stored as JSON, see hookFile, or as an HTTP request in
+// wire format
+func Parse(data []byte) (*Hook, error) {
+	if bytes.HasPrefix(bytes.TrimSpace(data), []byte("{")) {
+		return parseJSON(data)
+	}
+	return parseWire(data)
+}
+
+func parseJSON(data []byte) (*Hook, error) {
+	var file hookFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, err
+	}
+	body := file.Payload
+	if len(file.Body) > 0 {
+		body = file.Body
+		var text string
+		if err := json.Unmarshal(file.Body, &text); err == nil {
+			body = []byte(text)
+		}
+	}
+	hook := newHook(file.Method, file.Path, body)
+	hook.Provider = file.Provider
+	for name, value := range file.Headers {
+		hook.Headers[name] = value
+	}
+	return hook, nil
+}
+
+func parseWire(data []byte) (*Hook, error) {
+	reader := bufio.NewReader(bytes.NewReader(data))
+	req, err := http.ReadRequest(reader)
+	if err != nil {
+		return nil, err
+	}
+	// Without Content-Length, e.g. when the file was written by hand, the
+	// body is the rest of the file
+	body, err := ioutil.ReadAll(req.Body)
+	if err == nil && req.ContentLength <= 0 {
+		body, err = ioutil.ReadAll(reader)
+	}
+	if err != nil {
+		return nil, err
+	}
+	hook := newHook(req.Method, req.URL.Path, body)
+	for name := range req.Header {
+		hook.Headers[name] = req.Header.Get(name)
+	}
+	return hook, nil
+}
+
+// FromDelivery returns the hook of a delivery recorded by the proxy
+func FromDelivery(delivery proxy.Delivery) (*Hook, error) {
+	if delivery.Payload == nil {
+		return nil, fmt.Errorf("delivery '%s' has no payload, it was not kept", delivery.ID)
+	}
+	hook := newHook(delivery.Method, delivery.Path, delivery.Payload)
+	hook.Provider = delivery.Provider
+	hook.Name = delivery.ID
+	for name, value := range delivery.Headers {
+		hook.Headers[name] = value
+	}
+	return hook, nil
+}
+
+func newHook(method string, path string, body []byte) *Hook {
+	if len(method) == 0 {
+		method = http.MethodPost
+	}
+	return &Hook{
+		Hook: providers.Hook{
+			Payload:       body,
+			Headers:       make(map[string]string),
+			RequestMethod: method,
+		},
+		Path: path,
+	}
+}
+
+// provider returns the provider of the hook
+func (h *Hook) provider() (string, error) {
+	switch {
+	case len(h.Provider) > 0:
+		return strings.ToLower(h.Provider), nil
+	case len(h.Header(providers.XGitHubEvent)) > 0:
+		return providers.GithubProviderKind, nil
+	case len(h.Header(providers.XGitlabEvent)) > 0:
+		return providers.GitlabProviderKind, nil
+	}
+	return "", errors.New("cannot tell the provider of the hook from its headers")
+}
+
+// Sign replaces the signature of the hook with one computed with secret:
+// X-Hub-Signature and X-Hub-Signature-256 for GitHub, X-Gitlab-Token for GitLab
+func (h *Hook) Sign(secret string) error {
+	provider, err := h.provider()
+	if err != nil {
+		return err
+	}
+	switch provider {
+	case providers.GithubProviderKind:
+		h.setHeader(providers.XHubSignature, providers.SignaturePrefix+providers.HashPayload(secret, h.Payload))
+		mac := hmac.New(sha256.New, []byte(secret))
+		mac.Write(h.Payload)
+		h.setHeader(XHubSignature256, "sha256="+hex.EncodeToString(mac.Sum(nil)))
+	case providers.GitlabProviderKind:
+		h.setHeader(providers.XGitlabToken, secret)
+	default:
+		return fmt.Errorf("cannot sign hooks of provider '%s'", provider)
+	}
+	return nil
+}
+
+// setHeader sets a header, replacing it in any casing
+func (h *Hook) setHeader(name string, value string) {
+	for key := range h.Headers {
+		if strings.EqualFold(key, name) {
+			delete(h.Headers, key)
+		}
+	}
+	h.Headers[name] = value
+}
+
+// Event returns the event of the hook, read from its headers
+func (h *Hook) Event() string {
+	if event := h.Header(providers.XGitHubEvent); len(event) > 0 {
+		return event
+	}
+	return h.Header(providers.XGitlabEvent)
+}
+
+// NewRequest returns the request sending the hook to baseURL followed by the
+// path of the hook, as the proxy forwards hooks to an upstream. Headers
+// redacted by the proxy are left out.
+func (h *Hook) NewRequest(baseURL string) (*http.Request, error) {
+	req, err := http.NewRequest(h.RequestMethod, baseURL+h.Path, bytes.NewReader(h.Payload))
+	if err != nil {
+		return nil, err
+	}
+	for name, value := range h.Headers {
+		if value == proxy.Redacted || isSkippedHeader(name) {
+			continue
+		}
+		req.Header.Set(name, value)
+	}
+	return req, nil
+}
+
+func isSkippedHeader(name string) bool {
+	for _, skipped := range skippedHeaders {
+		if strings.EqualFold(skipped, name) {
+			return true
+		}
+	}
+	return false
+}
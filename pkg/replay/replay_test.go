@@ -0,0 +1,149 @@
+package replay
+
+import (
+	"io/ioutil"
+	"net/http"
+	"testing"
+
+	"github.com/stakater/GitWebhookProxy/pkg/providers"
+	"github.com/stakater/GitWebhookProxy/pkg/proxy"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name      string
+		data      string
+		wantPath  string
+		wantEvent string
+		wantBody  string
+	}{
+		{
+			name:      "JSONBodyObject",
+			data:      `{"path":"/github-webhook/","headers":{"X-GitHub-Event":"push"},"body":{"ref":"refs/heads/main"}}`,
+			wantPath:  "/github-webhook/",
+			wantEvent: "push",
+			wantBody:  `{"ref":"refs/heads/main"}`,
+		},
+		{
+			name:      "JSONBodyString",
+			data:      `{"path":"/hook","headers":{"X-Gitlab-Event":"Push Hook"},"body":"payload=%7B%7D"}`,
+			wantPath:  "/hook",
+			wantEvent: "Push Hook",
+			wantBody:  "payload=%7B%7D",
+		},
+		{
+			name:      "RecordedDelivery",
+			data:      `{"id":"1","path":"/hook","headers":{"X-GitHub-Event":"ping"},"payload":"e30="}`,
+			wantPath:  "/hook",
+			wantEvent: "ping",
+			wantBody:  "{}",
+		},
+		{
+			name:      "WireFormat",
+			data:      "POST /github-webhook/ HTTP/1.1\r\nHost: proxy\r\nX-GitHub-Event: push\r\nContent-Length: 2\r\n\r\n{}",
+			wantPath:  "/github-webhook/",
+			wantEvent: "push",
+			wantBody:  "{}",
+		},
+		{
+			name:      "WireFormatWithoutContentLength",
+			data:      "POST /hook HTTP/1.1\nX-Gitlab-Event: Push Hook\n\n{\"ref\":\"refs/heads/main\"}",
+			wantPath:  "/hook",
+			wantEvent: "Push Hook",
+			wantBody:  `{"ref":"refs/heads/main"}`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			hook, err := Parse([]byte(tt.data))
+			if err != nil {
+				t.Fatalf("Parse() error = %v", err)
+			}
+			if hook.Path != tt.wantPath || hook.Event() != tt.wantEvent || string(hook.Payload) != tt.wantBody {
+				t.Errorf("Parse() = %s %s %q, want %s %s %q", hook.Path, hook.Event(), hook.Payload, tt.wantPath, tt.wantEvent, tt.wantBody)
+			}
+			if hook.RequestMethod != http.MethodPost {
+				t.Errorf("Parse() method = %s, want POST", hook.RequestMethod)
+			}
+		})
+	}
+}
+
+func TestParseInvalid(t *testing.T) {
+	for _, data := range []string{`{"headers":`, "not a request"} {
+		if _, err := Parse([]byte(data)); err == nil {
+			t.Errorf("Parse(%q) succeeded, want an error", data)
+		}
+	}
+}
+
+func TestHook_Sign(t *testing.T) {
+	github := newHook("", "/hook", []byte(`{"zen":"Keep it logically awesome."}`))
+	github.Headers["X-Hub-Signature"] = proxy.Redacted
+	github.Headers[providers.XGitHubEvent] = "ping"
+	if err := github.Sign("secret"); err != nil {
+		t.Fatal(err)
+	}
+	provider, _ := providers.NewGithubProvider("secret")
+	if !provider.Validate(github.Hook) {
+		t.Errorf("signed GitHub hook does not validate, headers %v", github.Headers)
+	}
+	if len(github.Header(XHubSignature256)) != len("sha256=")+64 {
+		t.Errorf("%s = %q, want a SHA-256 signature", XHubSignature256, github.Header(XHubSignature256))
+	}
+
+	gitlab := newHook("", "/hook", []byte(`{}`))
+	gitlab.Provider = providers.GitlabProviderKind
+	if err := gitlab.Sign("token"); err != nil {
+		t.Fatal(err)
+	}
+	if gitlab.Header(providers.XGitlabToken) != "token" {
+		t.Errorf("%s = %q, want the secret", providers.XGitlabToken, gitlab.Header(providers.XGitlabToken))
+	}
+
+	if err := newHook("", "/hook", nil).Sign("secret"); err == nil {
+		t.Error("Sign() of a hook without provider succeeded, want an error")
+	}
+}
+
+func TestHook_NewRequest(t *testing.T) {
+	hook := newHook("", "/github-webhook/", []byte("{}"))
+	hook.Headers[providers.XGitHubEvent] = "push"
+	hook.Headers[providers.XGitlabToken] = proxy.Redacted
+	hook.Headers["Content-Length"] = "100"
+
+	req, err := hook.NewRequest("http://jenkins:8080")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if req.URL.String() != "http://jenkins:8080/github-webhook/" {
+		t.Errorf("NewRequest() URL = %s", req.URL)
+	}
+	if req.Header.Get(providers.XGitHubEvent) != "push" || len(req.Header.Get(providers.XGitlabToken)) > 0 {
+		t.Errorf("NewRequest() headers = %v, want the event without the redacted token", req.Header)
+	}
+	if body, _ := ioutil.ReadAll(req.Body); string(body) != "{}" || req.ContentLength != 2 {
+		t.Errorf("NewRequest() body = %q with length %d", body, req.ContentLength)
+	}
+}
+
+func TestFromDelivery(t *testing.T) {
+	hook, err := FromDelivery(proxy.Delivery{
+		ID:       "abc",
+		Provider: providers.GitlabProviderKind,
+		Path:     "/hook",
+		Method:   http.MethodPost,
+		Headers:  map[string]string{providers.XGitlabEvent: "Push Hook"},
+		Payload:  []byte("{}"),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if hook.Name != "abc" || hook.Provider != providers.GitlabProviderKind || hook.Event() != "Push Hook" {
+		t.Errorf("FromDelivery() = %+v", hook)
+	}
+
+	if _, err := FromDelivery(proxy.Delivery{ID: "large"}); err == nil {
+		t.Error("FromDelivery() of a delivery without payload succeeded, want an error")
+	}
+}
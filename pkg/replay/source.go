@@ -0,0 +1,159 @@
+package replay
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/stakater/GitWebhookProxy/pkg/proxy"
+)
+
+// maxDeliveryLine bounds a line of a delivery log file, a delivery keeps a
+// payload of up to 1 MiB which grows by a third once base64 encoded
+const maxDeliveryLine = 4 << 20
+
+// Filter selects the deliveries to replay, empty fields match any
+type Filter struct {
+	// IDs are the IDs of the deliveries, or the delivery IDs of the provider
+	IDs        []string
+	Since      time.Time
+	Until      time.Time
+	Repository string
+	Event      string
+	// Decision of the proxy. Coalesced pushes are left out unless asked
+	// for, the last push of a ref is recorded again when it is forwarded.
+	Decision string
+}
+
+// Match reports whether the delivery is selected by the filter
+func (f Filter) Match(delivery proxy.Delivery) bool {
+	if len(f.IDs) > 0 && !containsID(f.IDs, delivery) {
+		return false
+	}
+	if !f.Since.IsZero() && delivery.Time.Before(f.Since) {
+		return false
+	}
+	if !f.Until.IsZero() && !delivery.Time.Before(f.Until) {
+		return false
+	}
+	if len(f.Repository) > 0 && !strings.EqualFold(f.Repository, delivery.Repository) {
+		return false
+	}
+	if len(f.Event) > 0 && !strings.EqualFold(f.Event, delivery.Event) {
+		return false
+	}
+	if len(f.Decision) > 0 {
+		return f.Decision == delivery.Decision
+	}
+	return delivery.Decision != proxy.DecisionCoalesced
+}
+
+func containsID(ids []string, delivery proxy.Delivery) bool {
+	for _, id := range ids {
+		if id == delivery.ID || (len(delivery.DeliveryID) > 0 && id == delivery.DeliveryID) {
+			return true
+		}
+	}
+	return false
+}
+
+// Select returns the deliveries matching the filter, oldest first
+func Select(deliveries []proxy.Delivery, filter Filter) []proxy.Delivery {
+	selected := []proxy.Delivery{}
+	for _, delivery := range deliveries {
+		if filter.Match(delivery) {
+			selected = append(selected, delivery)
+		}
+	}
+	sort.SliceStable(selected, func(i, j int) bool {
+		return selected[i].Time.Before(selected[j].Time)
+	})
+	return selected
+}
+
+// LoadDeliveryLog reads the deliveries persisted by the proxy in its
+// deliveryLogFile
+func LoadDeliveryLog(path string) ([]proxy.Delivery, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	deliveries := []proxy.Delivery{}
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), maxDeliveryLine)
+	for line := 1; scanner.Scan(); line++ {
+		if len(strings.TrimSpace(scanner.Text())) == 0 {
+			continue
+		}
+		var delivery proxy.Delivery
+		if err := json.Unmarshal(scanner.Bytes(), &delivery); err != nil {
+			return nil, fmt.Errorf("Error reading delivery on line %d of '%s': %s", line, path, err)
+		}
+		deliveries = append(deliveries, delivery)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return deliveries, nil
+}
+
+// AdminClient reads deliveries from the admin API of a running proxy
+type AdminClient struct {
+	// URL of the admin listener, e.g. http://127.0.0.1:8081
+	URL    string
+	Token  string
+	Client *http.Client
+}
+
+// Deliveries returns the deliveries recorded by the proxy, without their
+// headers and payload
+func (c *AdminClient) Deliveries() ([]proxy.Delivery, error) {
+	deliveries := []proxy.Delivery{}
+	if err := c.get("/deliveries", &deliveries); err != nil {
+		return nil, err
+	}
+	return deliveries, nil
+}
+
+// Delivery returns a delivery with its headers and payload
+func (c *AdminClient) Delivery(id string) (proxy.Delivery, error) {
+	var delivery proxy.Delivery
+	err := c.get("/deliveries/"+url.PathEscape(id), &delivery)
+	return delivery, err
+}
+
+func (c *AdminClient) get(path string, v interface{}) error {
+	req, err := http.NewRequest(http.MethodGet, strings.TrimSuffix(c.URL, "/")+path, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+c.Token)
+
+	client := c.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("GET %s returned %s: %s", path, resp.Status, strings.TrimSpace(string(body)))
+	}
+	return json.Unmarshal(body, v)
+}
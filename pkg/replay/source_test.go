@@ -0,0 +1,126 @@
+package replay
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stakater/GitWebhookProxy/pkg/proxy"
+)
+
+func at(hour int) time.Time {
+	return time.Date(2020, 6, 1, hour, 0, 0, 0, time.UTC)
+}
+
+var testDeliveries = []proxy.Delivery{
+	{ID: "4", Time: at(13), Repository: "group/app", Event: "Push Hook", Decision: proxy.DecisionForwarded},
+	{ID: "1", Time: at(9), Repository: "group/app", Event: "Push Hook", Decision: proxy.DecisionForwarded, DeliveryID: "uuid-1"},
+	{ID: "2", Time: at(10), Repository: "group/lib", Event: "Push Hook", Decision: proxy.DecisionIgnored},
+	{ID: "3", Time: at(11), Repository: "group/app", Event: "Merge Request Hook", Decision: proxy.DecisionRejected},
+	{ID: "5", Time: at(12), Repository: "group/app", Event: "Push Hook", Decision: proxy.DecisionCoalesced},
+}
+
+func selectedIDs(deliveries []proxy.Delivery) string {
+	ids := []string{}
+	for _, delivery := range deliveries {
+		ids = append(ids, delivery.ID)
+	}
+	return strings.Join(ids, ",")
+}
+
+func TestSelect(t *testing.T) {
+	tests := []struct {
+		name   string
+		filter Filter
+		want   string
+	}{
+		{"All", Filter{}, "1,2,3,4"},
+		{"IDs", Filter{IDs: []string{"3", "uuid-1"}}, "1,3"},
+		{"Since", Filter{Since: at(10)}, "2,3,4"},
+		{"Until", Filter{Until: at(11)}, "1,2"},
+		{"Repository", Filter{Repository: "GROUP/APP"}, "1,3,4"},
+		{"Event", Filter{Event: "push hook", Repository: "group/app"}, "1,4"},
+		{"Decision", Filter{Decision: proxy.DecisionForwarded}, "1,4"},
+		{"Coalesced", Filter{Decision: proxy.DecisionCoalesced}, "5"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := selectedIDs(Select(testDeliveries, tt.filter)); got != tt.want {
+				t.Errorf("Select() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLoadDeliveryLog(t *testing.T) {
+	dir, err := ioutil.TempDir("", "replay")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "deliveries.jsonl")
+
+	var lines []string
+	for _, delivery := range testDeliveries[:2] {
+		data, _ := json.Marshal(delivery)
+		lines = append(lines, string(data))
+	}
+	if err := ioutil.WriteFile(file, []byte(strings.Join(lines, "\n")+"\n\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	deliveries, err := LoadDeliveryLog(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := selectedIDs(deliveries); got != "4,1" {
+		t.Errorf("LoadDeliveryLog() = %v, want 4,1", got)
+	}
+
+	ioutil.WriteFile(file, []byte("{\"id\":\n"), 0600)
+	if _, err := LoadDeliveryLog(file); err == nil {
+		t.Error("LoadDeliveryLog() of an invalid file succeeded, want an error")
+	}
+}
+
+func TestAdminClient(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer token" {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+		switch r.URL.Path {
+		case "/deliveries":
+			json.NewEncoder(w).Encode(testDeliveries)
+		case "/deliveries/1":
+			json.NewEncoder(w).Encode(proxy.Delivery{ID: "1", Payload: []byte("{}")})
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	admin := &AdminClient{URL: server.URL + "/", Token: "token"}
+	deliveries, err := admin.Deliveries()
+	if err != nil || len(deliveries) != len(testDeliveries) {
+		t.Errorf("Deliveries() = %v, %v", deliveries, err)
+	}
+	delivery, err := admin.Delivery("1")
+	if err != nil || string(delivery.Payload) != "{}" {
+		t.Errorf("Delivery() = %+v, %v", delivery, err)
+	}
+	if _, err := admin.Delivery("2"); err == nil {
+		t.Error("Delivery() of an unknown delivery succeeded, want an error")
+	}
+
+	admin.Token = "wrong"
+	if _, err := admin.Deliveries(); err == nil || !strings.Contains(err.Error(), "401") {
+		t.Errorf("Deliveries() with a wrong token = %v, want a 401 error", err)
+	}
+}
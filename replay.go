@@ -0,0 +1,229 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/namsral/flag"
+	"github.com/stakater/GitWebhookProxy/pkg/replay"
+)
+
+const replayUsage = `Usage: gitwebhookproxy replay [flags]
+
+Sends stored hooks again, either through the proxy (-proxy) or straight to
+an upstream (-upstream). Hooks are read from files (-file) or from the
+deliveries recorded by the proxy (-admin or -deliveryLogFile), selected by
+-delivery or -since. Flags can also be set as GWP_ environment variables,
+like those of the proxy.
+
+Flags:
+`
+
+// runReplay runs the replay subcommand and returns the exit code
+func runReplay(args []string) int {
+	replayFlags := flag.NewFlagSetWithEnvPrefix("replay", "GWP", flag.ContinueOnError)
+	files := replayFlags.String("file", "", "Comma-Separated String List of files holding a hook as JSON or as an HTTP request")
+	deliveryLogFile := replayFlags.String("deliveryLogFile", "", "Path to the file in which the proxy persists recent deliveries")
+	adminURL := replayFlags.String("admin", "", "URL of the admin listener of a running proxy, e.g. http://127.0.0.1:8081, to read recent deliveries from")
+	adminToken := replayFlags.String("adminToken", "", "Bearer token of the admin API")
+	deliveries := replayFlags.String("delivery", "", "Comma-Separated String List of recorded delivery IDs, or IDs sent by the provider, to replay")
+	since := replayFlags.String("since", "", "Replay recorded deliveries received at or after this time (RFC 3339)")
+	until := replayFlags.String("until", "", "Replay recorded deliveries received before this time (RFC 3339)")
+	repository := replayFlags.String("repository", "", "Replay recorded deliveries of this repository only, e.g. group/app")
+	event := replayFlags.String("event", "", "Replay recorded deliveries of this event only, e.g. push")
+	decision := replayFlags.String("decision", "", "Replay recorded deliveries with this decision only: forwarded, ignored, rejected or coalesced")
+	proxyURL := replayFlags.String("proxy", "", "URL of the proxy, the hook goes through the full pipeline at its recorded path")
+	upstreamURL := replayFlags.String("upstream", "", "URL of an upstream the hook is sent to directly, followed by its recorded path")
+	path := replayFlags.String("path", "", "Path to send the hooks to instead of their recorded path")
+	secret := replayFlags.String("secret", "", "Secret the hooks are signed with again. Needed for hooks whose signature was redacted")
+	provider := replayFlags.String("provider", "", "Git Provider of the hooks, read from their headers when empty")
+	dryRun := replayFlags.Bool("dryRun", false, "Print the requests instead of sending them")
+	timeout := replayFlags.Duration("timeout", time.Second*30, "Timeout of a single request")
+	replayFlags.Usage = func() {
+		fmt.Fprint(os.Stderr, replayUsage)
+		replayFlags.PrintDefaults()
+	}
+	if err := replayFlags.Parse(args); err != nil {
+		return 2
+	}
+
+	fail := func(format string, v ...interface{}) int {
+		log.Printf(format, v...)
+		return 2
+	}
+	if (len(*proxyURL) > 0) == (len(*upstreamURL) > 0) {
+		return fail("Exactly one of the flags 'proxy' and 'upstream' must be specified")
+	}
+	target := *proxyURL + *upstreamURL
+
+	// Sources are used in the order file, admin, deliveryLogFile, so that a
+	// GWP_DELIVERYLOGFILE set for the proxy does not get in the way
+	if len(*files) == 0 && len(*adminURL) == 0 && len(*deliveryLogFile) == 0 {
+		return fail("One of the flags 'file', 'admin' and 'deliveryLogFile' must be specified")
+	}
+	if len(*files) == 0 && len(*deliveries) == 0 && len(*since) == 0 {
+		return fail("Flag 'delivery' or 'since' must be specified to select recorded deliveries")
+	}
+
+	filter := replay.Filter{
+		Repository: *repository,
+		Event:      *event,
+		Decision:   *decision,
+	}
+	if len(*deliveries) > 0 {
+		filter.IDs = splitList(*deliveries)
+	}
+	times := []struct {
+		name  string
+		value string
+		dst   *time.Time
+	}{
+		{"since", *since, &filter.Since},
+		{"until", *until, &filter.Until},
+	}
+	for _, t := range times {
+		if len(t.value) == 0 {
+			continue
+		}
+		parsed, err := time.Parse(time.RFC3339, t.value)
+		if err != nil {
+			return fail("Flag '%s' must be a time like 2006-01-02T15:04:05Z: %s", t.name, err)
+		}
+		*t.dst = parsed
+	}
+
+	client := &http.Client{Timeout: *timeout}
+	var hooks []*replay.Hook
+	var err error
+	switch {
+	case len(*files) > 0:
+		hooks, err = hooksFromFiles(splitList(*files))
+	case len(*adminURL) > 0:
+		admin := &replay.AdminClient{URL: *adminURL, Token: *adminToken, Client: client}
+		hooks, err = hooksFromAdmin(admin, filter)
+	default:
+		hooks, err = hooksFromDeliveryLog(*deliveryLogFile, filter)
+	}
+	if err != nil {
+		log.Println(err)
+		return 1
+	}
+	if len(hooks) == 0 {
+		log.Println("No hooks to replay")
+		return 1
+	}
+
+	failed := 0
+	for _, hook := range hooks {
+		if err := replayHook(client, hook, target, *path, *provider, *secret, *dryRun); err != nil {
+			log.Printf("Error replaying '%s': %s", hook.Name, err)
+			failed++
+		}
+	}
+	log.Printf("Replayed %d of %d hook(s) to '%s'", len(hooks)-failed, len(hooks), target)
+	if failed > 0 {
+		return 1
+	}
+	return 0
+}
+
+func replayHook(client *http.Client, hook *replay.Hook, target string, path string, provider string, secret string, dryRun bool) error {
+	if len(path) > 0 {
+		hook.Path = path
+	}
+	if len(provider) > 0 {
+		hook.Provider = provider
+	}
+	if len(secret) > 0 {
+		if err := hook.Sign(secret); err != nil {
+			return err
+		}
+	}
+
+	req, err := hook.NewRequest(target)
+	if err != nil {
+		return err
+	}
+	if dryRun {
+		fmt.Printf("%s %s %s\n", hook.Name, req.Method, req.URL)
+		for name := range req.Header {
+			fmt.Printf("  %s: %s\n", name, req.Header.Get(name))
+		}
+		return nil
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	fmt.Printf("%s %s %s: %s\n", hook.Name, hook.Event(), req.URL, resp.Status)
+	if resp.StatusCode >= 400 {
+		return fmt.Errorf("'%s' returned %s", req.URL, resp.Status)
+	}
+	return nil
+}
+
+func hooksFromFiles(files []string) ([]*replay.Hook, error) {
+	hooks := []*replay.Hook{}
+	for _, file := range files {
+		hook, err := replay.LoadFile(file)
+		if err != nil {
+			return nil, err
+		}
+		hooks = append(hooks, hook)
+	}
+	return hooks, nil
+}
+
+func hooksFromDeliveryLog(file string, filter replay.Filter) ([]*replay.Hook, error) {
+	deliveries, err := replay.LoadDeliveryLog(file)
+	if err != nil {
+		return nil, err
+	}
+	hooks := []*replay.Hook{}
+	for _, delivery := range replay.Select(deliveries, filter) {
+		hook, err := replay.FromDelivery(delivery)
+		if err != nil {
+			return nil, err
+		}
+		hooks = append(hooks, hook)
+	}
+	return hooks, nil
+}
+
+// hooksFromAdmin selects deliveries from the list of the admin API, which
+// leaves out payloads, and then reads each of them
+func hooksFromAdmin(admin *replay.AdminClient, filter replay.Filter) ([]*replay.Hook, error) {
+	deliveries, err := admin.Deliveries()
+	if err != nil {
+		return nil, err
+	}
+	hooks := []*replay.Hook{}
+	for _, summary := range replay.Select(deliveries, filter) {
+		delivery, err := admin.Delivery(summary.ID)
+		if err != nil {
+			return nil, err
+		}
+		hook, err := replay.FromDelivery(delivery)
+		if err != nil {
+			return nil, err
+		}
+		hooks = append(hooks, hook)
+	}
+	return hooks, nil
+}
+
+func splitList(list string) []string {
+	items := []string{}
+	for _, item := range strings.Split(list, ",") {
+		if item = strings.TrimSpace(item); len(item) > 0 {
+			items = append(items, item)
+		}
+	}
+	return items
+}